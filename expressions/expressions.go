@@ -2,11 +2,27 @@ package expressions
 
 import "github.com/awgraves/go-lox/tokens"
 
+// ID identifies an expression node. The parser gives every node it creates a
+// distinct ID, so results of static analysis can be stored by node.
+type ID int
+
+// Binding is filled in by the resolver when a variable reference turns out to be
+// to a local variable: the number of environments between the reference and the
+// one defining the variable, and the variable's slot in it. The parser gives every
+// reference its own Binding, so the result lives and dies with the syntax tree.
+type Binding struct {
+	Resolved bool // false for references to globals
+	Depth    int
+	Slot     int
+}
+
 type Expression interface {
 	Accept(v Visitor) (interface{}, error)
+	Span() tokens.Span
 }
 
 type Binary struct {
+	ID       ID
 	Left     Expression
 	Operator tokens.Token
 	Right    Expression
@@ -16,15 +32,28 @@ func (e Binary) Accept(v Visitor) (interface{}, error) {
 	return v.VisitBinary(e)
 }
 
+func (e Binary) Span() tokens.Span {
+	return tokens.Join(e.Left.Span(), e.Right.Span())
+}
+
 type Grouping struct {
+	ID         ID
+	LeftParen  tokens.Token
 	Expression Expression
+	RightParen tokens.Token
 }
 
 func (e Grouping) Accept(v Visitor) (interface{}, error) {
 	return v.VisitGrouping(e)
 }
 
+func (e Grouping) Span() tokens.Span {
+	return tokens.Join(e.LeftParen.Span(), e.RightParen.Span())
+}
+
 type Literal struct {
+	ID    ID
+	Token tokens.Token // zero for literals synthesized by the parser
 	Value interface{}
 }
 
@@ -32,7 +61,12 @@ func (e Literal) Accept(v Visitor) (interface{}, error) {
 	return v.VisitLiteral(e)
 }
 
+func (e Literal) Span() tokens.Span {
+	return e.Token.Span()
+}
+
 type Unary struct {
+	ID       ID
 	Operator tokens.Token
 	Right    Expression
 }
@@ -41,24 +75,41 @@ func (e Unary) Accept(v Visitor) (interface{}, error) {
 	return v.VisitUnary(e)
 }
 
+func (e Unary) Span() tokens.Span {
+	return tokens.Join(e.Operator.Span(), e.Right.Span())
+}
+
 type Variable struct {
-	Name tokens.Token
+	ID      ID
+	Name    tokens.Token
+	Binding *Binding
 }
 
 func (e Variable) Accept(v Visitor) (interface{}, error) {
 	return v.VisitVariable(e)
 }
 
+func (e Variable) Span() tokens.Span {
+	return e.Name.Span()
+}
+
 type Assign struct {
-	Name  tokens.Token
-	Value Expression
+	ID      ID
+	Name    tokens.Token
+	Value   Expression
+	Binding *Binding
 }
 
 func (e Assign) Accept(v Visitor) (interface{}, error) {
 	return v.VisitAssign(e)
 }
 
+func (e Assign) Span() tokens.Span {
+	return tokens.Join(e.Name.Span(), e.Value.Span())
+}
+
 type Logical struct {
+	ID       ID
 	Left     Expression
 	Operator tokens.Token
 	Right    Expression
@@ -68,7 +119,12 @@ func (e Logical) Accept(v Visitor) (interface{}, error) {
 	return v.VisitLogical(e)
 }
 
+func (e Logical) Span() tokens.Span {
+	return tokens.Join(e.Left.Span(), e.Right.Span())
+}
+
 type Call struct {
+	ID        ID
 	Callee    Expression
 	Paren     tokens.Token
 	Arguments []Expression
@@ -77,3 +133,127 @@ type Call struct {
 func (e Call) Accept(v Visitor) (interface{}, error) {
 	return v.VisitCall(e)
 }
+
+func (e Call) Span() tokens.Span {
+	return tokens.Join(e.Callee.Span(), e.Paren.Span())
+}
+
+type Get struct {
+	ID     ID
+	Object Expression
+	Name   tokens.Token
+}
+
+func (e Get) Accept(v Visitor) (interface{}, error) {
+	return v.VisitGet(e)
+}
+
+func (e Get) Span() tokens.Span {
+	return tokens.Join(e.Object.Span(), e.Name.Span())
+}
+
+type Set struct {
+	ID     ID
+	Object Expression
+	Name   tokens.Token
+	Value  Expression
+}
+
+func (e Set) Accept(v Visitor) (interface{}, error) {
+	return v.VisitSet(e)
+}
+
+func (e Set) Span() tokens.Span {
+	return tokens.Join(e.Object.Span(), e.Value.Span())
+}
+
+type This struct {
+	ID      ID
+	Keyword tokens.Token
+	Binding *Binding
+}
+
+func (e This) Accept(v Visitor) (interface{}, error) {
+	return v.VisitThis(e)
+}
+
+func (e This) Span() tokens.Span {
+	return e.Keyword.Span()
+}
+
+type Super struct {
+	ID      ID
+	Keyword tokens.Token
+	Method  tokens.Token
+	Binding *Binding
+}
+
+func (e Super) Accept(v Visitor) (interface{}, error) {
+	return v.VisitSuper(e)
+}
+
+func (e Super) Span() tokens.Span {
+	return tokens.Join(e.Keyword.Span(), e.Method.Span())
+}
+
+type List struct {
+	ID           ID
+	LeftBracket  tokens.Token
+	Elements     []Expression
+	RightBracket tokens.Token
+}
+
+func (e List) Accept(v Visitor) (interface{}, error) {
+	return v.VisitList(e)
+}
+
+func (e List) Span() tokens.Span {
+	return tokens.Join(e.LeftBracket.Span(), e.RightBracket.Span())
+}
+
+type Index struct {
+	ID      ID
+	Object  Expression
+	Index   Expression
+	Bracket tokens.Token // the closing bracket
+}
+
+func (e Index) Accept(v Visitor) (interface{}, error) {
+	return v.VisitIndex(e)
+}
+
+func (e Index) Span() tokens.Span {
+	return tokens.Join(e.Object.Span(), e.Bracket.Span())
+}
+
+type SetIndex struct {
+	ID      ID
+	Object  Expression
+	Index   Expression
+	Bracket tokens.Token // the closing bracket
+	Value   Expression
+}
+
+func (e SetIndex) Accept(v Visitor) (interface{}, error) {
+	return v.VisitSetIndex(e)
+}
+
+func (e SetIndex) Span() tokens.Span {
+	return tokens.Join(e.Object.Span(), e.Value.Span())
+}
+
+type Map struct {
+	ID         ID
+	LeftBrace  tokens.Token
+	Keys       []Expression
+	Values     []Expression
+	RightBrace tokens.Token
+}
+
+func (e Map) Accept(v Visitor) (interface{}, error) {
+	return v.VisitMap(e)
+}
+
+func (e Map) Span() tokens.Span {
+	return tokens.Join(e.LeftBrace.Span(), e.RightBrace.Span())
+}
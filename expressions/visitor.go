@@ -9,4 +9,12 @@ type Visitor interface {
 	VisitAssign(Assign) (interface{}, error)
 	VisitLogical(Logical) (interface{}, error)
 	VisitCall(Call) (interface{}, error)
+	VisitGet(Get) (interface{}, error)
+	VisitSet(Set) (interface{}, error)
+	VisitThis(This) (interface{}, error)
+	VisitSuper(Super) (interface{}, error)
+	VisitList(List) (interface{}, error)
+	VisitIndex(Index) (interface{}, error)
+	VisitSetIndex(SetIndex) (interface{}, error)
+	VisitMap(Map) (interface{}, error)
 }
@@ -1,14 +1,52 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/awgraves/go-lox/runtime"
 )
 
 func main() {
-	args := os.Args[1:]
+	color := flag.Bool("color", true, "colorize output and diagnostics")
+	useVM := flag.Bool("vm", false, "run on the bytecode virtual machine instead of the tree-walker")
+	allow := flag.String("allow", "io,os,time,random,net", "comma separated capabilities granted to scripts; empty for none")
+	searchPath := flag.String("path", "", "list of directories searched for imported modules, separated by the OS path list separator")
+	trace := flag.String("trace", "", "write scanner, parser, resolver and interpreter events to stderr as text or json")
+	flag.Parse()
+	args := flag.Args()
+
+	opts := []runtime.Option{runtime.WithColor(*color)}
+	if *useVM {
+		opts = append(opts, runtime.WithBackend(runtime.BytecodeVM))
+	}
+	caps := []runtime.Capability{}
+	for _, name := range strings.Split(*allow, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		c, err := runtime.ParseCapability(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(64)
+		}
+		caps = append(caps, c)
+	}
+	opts = append(opts, runtime.WithCapabilities(caps...))
+	if *searchPath != "" {
+		opts = append(opts, runtime.WithSearchPath(filepath.SplitList(*searchPath)...))
+	}
+	if *trace != "" {
+		format, err := runtime.ParseTraceFormat(*trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(64)
+		}
+		opts = append(opts, runtime.WithTrace(os.Stderr, format))
+	}
 
 	// TMP testing purposes
 	//astPrinter := expressions.AstPrinter{}
@@ -26,12 +64,12 @@ func main() {
 
 	switch len(args) {
 	case 0:
-		runtime.RunPrompt()
+		runtime.RunPrompt(opts...)
 		return
 	case 1:
-		runtime.RunFile(args[0])
+		runtime.RunFile(args[0], opts...)
 		return
 	default:
-		fmt.Println("Usage: lox [path/to/script.lx]")
+		fmt.Fprintln(os.Stderr, "Usage: lox [-color=false] [-vm] [-allow=io,time] [-path=dir1:dir2] [-trace=text|json] [path/to/script.lx]")
 	}
 }
@@ -0,0 +1,51 @@
+package runtime_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awgraves/go-lox/runtime"
+)
+
+// BenchmarkScripts runs every script in bench/ on each backend, in a new
+// interpreter per run so no state is carried from one run to the next.
+// Filter them with -bench, e.g. -bench 'Scripts/vm/fib'.
+func BenchmarkScripts(b *testing.B) {
+	paths, err := filepath.Glob(filepath.Join("..", "bench", "*.lx"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if len(paths) == 0 {
+		b.Fatal("no scripts in bench/")
+	}
+
+	backends := []struct {
+		name    string
+		backend runtime.Backend
+	}{
+		{"treewalker", runtime.TreeWalker},
+		{"vm", runtime.BytecodeVM},
+	}
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			for _, path := range paths {
+				src, err := os.ReadFile(path)
+				if err != nil {
+					b.Fatal(err)
+				}
+				name := strings.TrimSuffix(filepath.Base(path), ".lx")
+				b.Run(name, func(b *testing.B) {
+					for n := 0; n < b.N; n++ {
+						in := runtime.New(runtime.WithBackend(backend.backend), runtime.WithStdout(io.Discard))
+						if _, err := in.Eval(string(src)); err != nil {
+							b.Fatalf("%s: %s", path, err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
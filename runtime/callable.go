@@ -5,54 +5,95 @@ import (
 	"time"
 
 	"github.com/awgraves/go-lox/statements"
+	"github.com/awgraves/go-lox/tokens"
 )
 
+// thisToken names the instance bound to a method's closure.
+var thisToken = tokens.Token{TokenType: tokens.THIS, Lexeme: "this"}
+
 type LoxCallable interface {
 	Arity() int
 	Call(interp *interpreter, args []interface{}) (interface{}, error)
 	String() string
 }
 
-type Clock struct{}
+// Variadic is the arity of a native function accepting any number of arguments.
+const Variadic = -1
+
+// NativeFn is the Go implementation of a native function.
+type NativeFn func(args []Value) (Value, error)
+
+type NativeFunction struct {
+	Name  string
+	arity int
+	Fn    NativeFn
+}
+
+func NewNativeFunction(name string, arity int, fn NativeFn) *NativeFunction {
+	return &NativeFunction{Name: name, arity: arity, Fn: fn}
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
 
-func (c Clock) Arity() int {
-	return 0
+func (n *NativeFunction) Call(interp *interpreter, args []interface{}) (interface{}, error) {
+	return n.Fn(args)
 }
 
-func (c Clock) Call(interp *interpreter, args []interface{}) (interface{}, error) {
-	return time.Now().Unix(), nil
+func (n *NativeFunction) String() string {
+	return fmt.Sprintf("<native fn %s>", n.Name)
 }
 
-func (c Clock) String() string {
-	return "<native fn>"
+// clock returns the seconds elapsed since the unix epoch.
+func clock(args []Value) (Value, error) {
+	return float64(time.Now().UnixNano()) / float64(time.Second), nil
 }
 
 type LoxFunction struct {
-	Closure     Environment
-	Declaration statements.FunctionStmt
+	Closure       *localEnvironment
+	Declaration   statements.FunctionStmt
+	isInitializer bool
+	globals       *environment
 }
 
-func (l LoxFunction) Arity() int {
-	return len(l.Declaration.Params)
+// bind returns a copy of the method whose closure has "this" bound to the instance.
+func (l *LoxFunction) bind(instance *LoxInstance) *LoxFunction {
+	env := newLocalEnvironment(l.Closure, 1)
+	env.define(instance)
+	return &LoxFunction{Closure: env, Declaration: l.Declaration, isInitializer: l.isInitializer, globals: l.globals}
 }
 
-func (l LoxFunction) Call(interp *interpreter, args []interface{}) (interface{}, error) {
-	env := newEnvironment(l.Closure)
+func (l *LoxFunction) Arity() int {
+	return len(l.Declaration.Params)
+}
 
+func (l *LoxFunction) Call(interp *interpreter, args []interface{}) (interface{}, error) {
+	env := newLocalEnvironment(l.Closure, len(l.Declaration.Params))
 	for i := 0; i < len(l.Declaration.Params); i++ {
-		env.define(l.Declaration.Params[i].Lexeme, args[i])
+		env.define(args[i])
 	}
 
+	// global names resolve in the script or module the function was declared in
+	previous := interp.globals
+	interp.globals = l.globals
 	err := interp.executeBlock(l.Declaration.Body, env)
+	interp.globals = previous
 
 	val, ok := err.(*ReturnValue)
 	if ok {
+		if l.isInitializer {
+			return l.Closure.getAt(0, 0), nil
+		}
 		return val.Value, nil
 	}
+	if err == nil && l.isInitializer {
+		return l.Closure.getAt(0, 0), nil
+	}
 
 	return nil, err
 }
 
-func (l LoxFunction) String() string {
+func (l *LoxFunction) String() string {
 	return fmt.Sprintf("<fn %s>", l.Declaration.Name.Lexeme)
 }
@@ -0,0 +1,95 @@
+package runtime
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+)
+
+// Capability names a group of natives that reach outside the interpreter.
+// Natives of a group that was not granted are left undefined, for the script
+// and every module it imports.
+type Capability string
+
+const (
+	CapabilityIO     Capability = "io"     // files, standard input and importing modules from files
+	CapabilityOS     Capability = "os"     // environment variables and the process
+	CapabilityTime   Capability = "time"   // the clock
+	CapabilityRandom Capability = "random" // random numbers
+	CapabilityNet    Capability = "net"    // reserved for network access; no natives use it yet
+)
+
+// AllCapabilities are granted unless WithCapabilities says otherwise.
+var AllCapabilities = []Capability{CapabilityIO, CapabilityOS, CapabilityTime, CapabilityRandom, CapabilityNet}
+
+// ParseCapability returns the capability with the given name.
+func ParseCapability(name string) (Capability, error) {
+	for _, c := range AllCapabilities {
+		if string(c) == name {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown capability %q", name)
+}
+
+// WithCapabilities grants only the listed capabilities. Pass none to sandbox
+// scripts completely.
+func WithCapabilities(caps ...Capability) Option {
+	return func(in *Interpreter) {
+		in.capabilities = make(map[Capability]bool)
+		for _, c := range caps {
+			in.capabilities[c] = true
+		}
+	}
+}
+
+func (in *Interpreter) granted(c Capability) bool {
+	return in.capabilities == nil || in.capabilities[c]
+}
+
+var osNatives = []nativeDef{
+	{"getenv", 1, osGetenv},
+	{"exit", 1, osExit},
+}
+
+// osGetenv returns the environment variable's value, or nil when it isn't set.
+func osGetenv(args []Value) (Value, error) {
+	name, err := argString("getenv", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// ExitError ends a run in which the script called exit. Like an AbortError it
+// can't be caught by the script. The interpreter never exits the process itself;
+// the host decides what the status code means.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Script exited with status %d.", e.Code)
+}
+
+// osExit stops the program with the status code.
+func osExit(args []Value) (Value, error) {
+	code, err := argInteger("exit", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return nil, &ExitError{Code: code}
+}
+
+var randomNatives = []nativeDef{
+	{"random", 0, randomNumber},
+}
+
+// randomNumber returns a number in [0, 1).
+func randomNumber(args []Value) (Value, error) {
+	return rand.Float64(), nil
+}
@@ -0,0 +1,76 @@
+package runtime
+
+import (
+	"github.com/awgraves/go-lox/tokens"
+)
+
+type opcode byte
+
+const (
+	opConstant     opcode = iota // [constant uint16]
+	opNil                        //
+	opTrue                       //
+	opFalse                      //
+	opPop                        //
+	opGetLocal                   // [slot uint8]
+	opSetLocal                   // [slot uint8]
+	opGetGlobal                  // [name uint16]
+	opDefineGlobal               // [name uint16]
+	opSetGlobal                  // [name uint16]
+	opGetUpvalue                 // [index uint8]
+	opSetUpvalue                 // [index uint8]
+	opGetProperty                // [name uint16]
+	opSetProperty                // [name uint16]
+	opGetSuper                   // [name uint16]
+	opEqual                      //
+	opGreater                    //
+	opGreaterEqual               //
+	opLess                       //
+	opLessEqual                  //
+	opAdd                        //
+	opSubtract                   //
+	opMultiply                   //
+	opDivide                     //
+	opNot                        //
+	opNegate                     //
+	opPrint                      //
+	opJump                       // [offset uint16]
+	opJumpIfFalse                // [offset uint16]
+	opLoop                       // [offset uint16]
+	opCall                       // [argCount uint8]
+	opClosure                    // [function uint16] then [isLocal uint8, index uint8] per upvalue
+	opCloseUpvalue               //
+	opReturn                     //
+	opClass                      // [name uint16]
+	opInherit                    //
+	opMethod                     // [name uint16]
+	opBuildList                  // [count uint16]
+	opGetIndex                   //
+	opSetIndex                   //
+	opBuildMap                   // [count uint16] of key value pairs
+	opPushHandler                // [offset uint16] to the catch code
+	opPopHandler                 //
+	opCatch                      //
+	opThrow                      //
+	opImport                     // [path uint16]
+	opImportAll                  //
+)
+
+// chunk is a compiled sequence of bytecode.
+// spans holds the source of every byte in code so runtime errors can be located.
+type chunk struct {
+	code      []byte
+	spans     []tokens.Span
+	constants []Value
+}
+
+func (c *chunk) write(b byte, span tokens.Span) {
+	c.code = append(c.code, b)
+	c.spans = append(c.spans, span)
+}
+
+// addConstant returns the index of the value in the constant pool.
+func (c *chunk) addConstant(value Value) int {
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
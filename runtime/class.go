@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+type LoxClass struct {
+	Name       string
+	Superclass *LoxClass // possibly nil
+	Methods    map[string]*LoxFunction
+}
+
+// findMethod looks the method up on this class, then up the superclass chain.
+func (c *LoxClass) findMethod(name string) (*LoxFunction, bool) {
+	method, ok := c.Methods[name]
+	if ok {
+		return method, true
+	}
+
+	if c.Superclass != nil {
+		return c.Superclass.findMethod(name)
+	}
+	return nil, false
+}
+
+func (c *LoxClass) Arity() int {
+	initializer, ok := c.findMethod("init")
+	if !ok {
+		return 0
+	}
+	return initializer.Arity()
+}
+
+// Call creates a new instance, running the class's initializer if it has one.
+func (c *LoxClass) Call(interp *interpreter, args []interface{}) (interface{}, error) {
+	instance := newLoxInstance(c)
+
+	initializer, ok := c.findMethod("init")
+	if ok {
+		_, err := initializer.bind(instance).Call(interp, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return instance, nil
+}
+
+func (c *LoxClass) String() string {
+	return c.Name
+}
+
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]interface{}
+}
+
+func newLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{
+		class:  class,
+		fields: make(map[string]interface{}),
+	}
+}
+
+// get looks up a field first, falling back to a method bound to this instance.
+func (l *LoxInstance) get(name tokens.Token) (interface{}, error) {
+	value, ok := l.fields[name.Lexeme]
+	if ok {
+		return value, nil
+	}
+
+	method, ok := l.class.findMethod(name.Lexeme)
+	if ok {
+		return method.bind(l), nil
+	}
+
+	return nil, newRuntimeError(name.Span(), "Undefined property '%s'.", name.Lexeme)
+}
+
+func (l *LoxInstance) set(name tokens.Token, value interface{}) {
+	l.fields[name.Lexeme] = value
+}
+
+func (l *LoxInstance) String() string {
+	return fmt.Sprintf("%s instance", l.class.Name)
+}
@@ -6,3 +6,11 @@ const (
 	BLUE        = "\033[34m"
 	RED         = "\033[31m"
 )
+
+// paint wraps s in the color code when colors are enabled.
+func paint(enabled bool, color string, s string) string {
+	if !enabled {
+		return s
+	}
+	return color + s + RESET_COLOR
+}
@@ -0,0 +1,784 @@
+package runtime
+
+import (
+	"math"
+
+	"github.com/awgraves/go-lox/expressions"
+	"github.com/awgraves/go-lox/statements"
+	"github.com/awgraves/go-lox/tokens"
+)
+
+const (
+	maxLocals    = math.MaxUint8 + 1
+	maxUpvalues  = math.MaxUint8 + 1
+	maxConstants = math.MaxUint16 + 1
+	maxJump      = math.MaxUint16
+)
+
+type local struct {
+	name       string
+	depth      int // -1 until the variable's initializer has been compiled
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   uint8
+	isLocal bool
+}
+
+// funcCompiler holds the state of the function currently being compiled.
+type funcCompiler struct {
+	enclosing  *funcCompiler
+	function   *vmFunction
+	ftype      functionType
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	names      map[string]int // constant index of every identifier already in the pool
+	loops      []*loop        // innermost last
+	handlers   []handlerScope // try bodies and catch clauses being compiled, innermost last
+}
+
+// handlerScope is a region of code covered by a vm handler. Jumping out of it
+// must remove the handler and run the try statement's finally block first.
+type handlerScope struct {
+	finally *statements.Block // might be nil
+	loops   int               // loops enclosing the try statement
+}
+
+// loop tracks the jumps out of a loop body that are patched once its end is compiled.
+type loop struct {
+	scopeDepth    int // scope depth outside the body
+	breakJumps    []int
+	continueJumps []int
+}
+
+// compiler turns resolved statements into bytecode for the vm.
+// The resolver has already rejected invalid programs, so the compiler
+// only reports the limits imposed by the bytecode format.
+type compiler struct {
+	current     *funcCompiler
+	errReporter ErrorReporter
+	hadError    bool
+}
+
+// compile compiles a whole script into a function taking no arguments.
+// When the last statement is an expression statement, the function returns its value.
+func compile(stmts []statements.Stmt, errReporter ErrorReporter) (*vmFunction, bool) {
+	c := &compiler{errReporter: errReporter}
+	c.beginFunction(functionNone, "")
+
+	for n, stmt := range stmts {
+		if exp, ok := stmt.(statements.ExpStmt); ok && n == len(stmts)-1 {
+			c.expression(exp.Expression)
+			c.emit(exp.Span(), byte(opReturn))
+			return c.endFunction(), !c.hadError
+		}
+		c.statement(stmt)
+	}
+
+	c.emitReturn(tokens.Span{})
+	return c.endFunction(), !c.hadError
+}
+
+func (c *compiler) error(span tokens.Span, message string) {
+	c.hadError = true
+	c.errReporter.AddError(Diagnostic{Category: CategoryCompile, Span: span, Message: message})
+}
+
+func (c *compiler) chunk() *chunk {
+	return &c.current.function.chunk
+}
+
+func (c *compiler) beginFunction(ftype functionType, name string) {
+	fc := &funcCompiler{
+		enclosing: c.current,
+		function:  &vmFunction{name: name},
+		ftype:     ftype,
+		names:     make(map[string]int),
+	}
+
+	// slot zero holds the callee, or the receiver for methods
+	receiver := ""
+	if ftype == functionMethod || ftype == functionInitializer {
+		receiver = "this"
+	}
+	fc.locals = append(fc.locals, local{name: receiver, depth: 0})
+
+	c.current = fc
+}
+
+func (c *compiler) endFunction() *vmFunction {
+	function := c.current.function
+	function.upvalueCount = len(c.current.upvalues)
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *compiler) emit(span tokens.Span, bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, span)
+	}
+}
+
+func (c *compiler) emitShort(span tokens.Span, op opcode, operand int) {
+	c.emit(span, byte(op), byte(operand>>8), byte(operand))
+}
+
+func (c *compiler) emitReturn(span tokens.Span) {
+	if c.current.ftype == functionInitializer {
+		c.emit(span, byte(opGetLocal), 0)
+	} else {
+		c.emit(span, byte(opNil))
+	}
+	c.emit(span, byte(opReturn))
+}
+
+func (c *compiler) makeConstant(span tokens.Span, value Value) int {
+	index := c.chunk().addConstant(value)
+	if index >= maxConstants {
+		c.error(span, "Too many constants in one chunk.")
+		return 0
+	}
+	return index
+}
+
+func (c *compiler) emitConstant(span tokens.Span, value Value) {
+	c.emitShort(span, opConstant, c.makeConstant(span, value))
+}
+
+func (c *compiler) identifierConstant(name tokens.Token) int {
+	if index, ok := c.current.names[name.Lexeme]; ok {
+		return index
+	}
+	index := c.makeConstant(name.Span(), name.Lexeme)
+	c.current.names[name.Lexeme] = index
+	return index
+}
+
+// emitJump writes a jump with a placeholder offset and returns where to patch it.
+func (c *compiler) emitJump(span tokens.Span, op opcode) int {
+	c.emitShort(span, op, 0xffff)
+	return len(c.chunk().code) - 2
+}
+
+func (c *compiler) patchJump(span tokens.Span, offset int) {
+	jump := len(c.chunk().code) - offset - 2
+	if jump > maxJump {
+		c.error(span, "Too much code to jump over.")
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(span tokens.Span, loopStart int) {
+	offset := len(c.chunk().code) - loopStart + 3
+	if offset > maxJump {
+		c.error(span, "Loop body too large.")
+	}
+	c.emitShort(span, opLoop, offset)
+}
+
+func (c *compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope discards the scope's locals, closing those captured by a closure.
+func (c *compiler) endScope(span tokens.Span) {
+	fc := c.current
+	fc.scopeDepth--
+
+	for len(fc.locals) > 0 && fc.locals[len(fc.locals)-1].depth > fc.scopeDepth {
+		if fc.locals[len(fc.locals)-1].isCaptured {
+			c.emit(span, byte(opCloseUpvalue))
+		} else {
+			c.emit(span, byte(opPop))
+		}
+		fc.locals = fc.locals[:len(fc.locals)-1]
+	}
+}
+
+func (c *compiler) addLocal(name tokens.Token) {
+	if len(c.current.locals) >= maxLocals {
+		c.error(name.Span(), "Too many local variables in function.")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: -1})
+}
+
+// declareVariable adds a local for the name; globals are late bound and need no declaration.
+func (c *compiler) declareVariable(name tokens.Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name)
+}
+
+func (c *compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+// defineVariable binds the value on top of the stack to the declared name.
+func (c *compiler) defineVariable(name tokens.Token) {
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitShort(name.Span(), opDefineGlobal, c.identifierConstant(name))
+}
+
+func resolveLocal(fc *funcCompiler, name string) int {
+	for i := len(fc.locals) - 1; i >= 0; i-- {
+		if fc.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *compiler) addUpvalue(fc *funcCompiler, span tokens.Span, index uint8, isLocal bool) int {
+	for i, uv := range fc.upvalues {
+		if uv.index == index && uv.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(fc.upvalues) >= maxUpvalues {
+		c.error(span, "Too many closure variables in function.")
+		return 0
+	}
+
+	fc.upvalues = append(fc.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(fc.upvalues) - 1
+}
+
+// resolveUpvalue finds the name in an enclosing function, threading it through every function in between.
+func (c *compiler) resolveUpvalue(fc *funcCompiler, span tokens.Span, name string) int {
+	if fc.enclosing == nil {
+		return -1
+	}
+
+	if slot := resolveLocal(fc.enclosing, name); slot != -1 {
+		fc.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(fc, span, uint8(slot), true)
+	}
+
+	if index := c.resolveUpvalue(fc.enclosing, span, name); index != -1 {
+		return c.addUpvalue(fc, span, uint8(index), false)
+	}
+
+	return -1
+}
+
+func (c *compiler) namedVariable(name tokens.Token, assign expressions.Expression) {
+	var getOp, setOp opcode
+	var operand int
+	short := false
+
+	if slot := resolveLocal(c.current, name.Lexeme); slot != -1 {
+		getOp, setOp, operand = opGetLocal, opSetLocal, slot
+	} else if index := c.resolveUpvalue(c.current, name.Span(), name.Lexeme); index != -1 {
+		getOp, setOp, operand = opGetUpvalue, opSetUpvalue, index
+	} else {
+		getOp, setOp, operand = opGetGlobal, opSetGlobal, c.identifierConstant(name)
+		short = true
+	}
+
+	op := getOp
+	if assign != nil {
+		c.expression(assign)
+		op = setOp
+	}
+
+	if short {
+		c.emitShort(name.Span(), op, operand)
+	} else {
+		c.emit(name.Span(), byte(op), byte(operand))
+	}
+}
+
+func (c *compiler) statement(stmt statements.Stmt) {
+	stmt.Accept(c)
+}
+
+func (c *compiler) expression(expr expressions.Expression) {
+	expr.Accept(c)
+}
+
+func (c *compiler) function(stmt statements.FunctionStmt, ftype functionType) {
+	c.beginFunction(ftype, stmt.Name.Lexeme)
+	c.beginScope()
+
+	c.current.function.arity = len(stmt.Params)
+	for _, param := range stmt.Params {
+		c.declareVariable(param)
+		c.defineVariable(param)
+	}
+
+	for _, s := range stmt.Body {
+		c.statement(s)
+	}
+	c.emitReturn(stmt.Span())
+
+	// no endScope: returning from the function discards its whole stack window
+	upvalues := c.current.upvalues
+	function := c.endFunction()
+
+	c.emitShort(stmt.Span(), opClosure, c.makeConstant(stmt.Span(), function))
+	for _, uv := range upvalues {
+		isLocal := byte(0)
+		if uv.isLocal {
+			isLocal = 1
+		}
+		c.emit(stmt.Span(), isLocal, uv.index)
+	}
+}
+
+func (c *compiler) VisitClassStmt(stmt statements.ClassStmt) error {
+	nameConstant := c.identifierConstant(stmt.Name)
+	c.declareVariable(stmt.Name)
+
+	c.emitShort(stmt.Name.Span(), opClass, nameConstant)
+	c.defineVariable(stmt.Name)
+
+	if stmt.Superclass != nil {
+		c.namedVariable(stmt.Superclass.Name, nil)
+
+		c.beginScope()
+		c.addLocal(tokens.Token{TokenType: tokens.SUPER, Lexeme: "super"})
+		c.defineVariable(stmt.Superclass.Name)
+
+		c.namedVariable(stmt.Name, nil)
+		c.emit(stmt.Superclass.Span(), byte(opInherit))
+	}
+
+	// keep the class on the stack while its methods are attached
+	c.namedVariable(stmt.Name, nil)
+	for _, method := range stmt.Methods {
+		ftype := functionMethod
+		if method.Name.Lexeme == "init" {
+			ftype = functionInitializer
+		}
+		c.function(method, ftype)
+		c.emitShort(method.Name.Span(), opMethod, c.identifierConstant(method.Name))
+	}
+	c.emit(stmt.Name.Span(), byte(opPop))
+
+	if stmt.Superclass != nil {
+		c.endScope(stmt.Name.Span())
+	}
+	return nil
+}
+
+func (c *compiler) VisitExpressionStmt(stmt statements.ExpStmt) error {
+	c.expression(stmt.Expression)
+	c.emit(stmt.Span(), byte(opPop))
+	return nil
+}
+
+func (c *compiler) VisitFunctionStmt(stmt statements.FunctionStmt) error {
+	c.declareVariable(stmt.Name)
+	// initialized straight away so the function can refer to itself
+	c.markInitialized()
+	c.function(stmt, functionFunction)
+	c.defineVariable(stmt.Name)
+	return nil
+}
+
+func (c *compiler) VisitPrintStmt(stmt statements.PrintStmt) error {
+	c.expression(stmt.Expression)
+	c.emit(stmt.Keyword.Span(), byte(opPrint))
+	return nil
+}
+
+func (c *compiler) VisitReturnStmt(stmt statements.ReturnStmt) error {
+	if stmt.Value == nil {
+		c.exitHandlers(stmt.Keyword.Span(), 0)
+		c.emitReturn(stmt.Keyword.Span())
+		return nil
+	}
+
+	c.expression(stmt.Value)
+	if len(c.current.handlers) == 0 {
+		c.emit(stmt.Keyword.Span(), byte(opReturn))
+		return nil
+	}
+
+	// the value waits in a nameless local while finally blocks run, so their own locals don't overlap it
+	fc := c.current
+	fc.scopeDepth++
+	c.addLocal(tokens.Token{})
+	c.markInitialized()
+	c.exitHandlers(stmt.Keyword.Span(), 0)
+	c.emit(stmt.Keyword.Span(), byte(opReturn))
+	fc.scopeDepth--
+	fc.locals = fc.locals[:len(fc.locals)-1]
+	return nil
+}
+
+func (c *compiler) VisitVarStmt(stmt statements.VarStmt) error {
+	c.declareVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emit(stmt.Name.Span(), byte(opNil))
+	}
+
+	c.defineVariable(stmt.Name)
+	return nil
+}
+
+func (c *compiler) VisitBlock(stmt statements.Block) error {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		c.statement(s)
+	}
+	c.endScope(stmt.Span())
+	return nil
+}
+
+func (c *compiler) VisitIfStmt(stmt statements.IfStmt) error {
+	span := stmt.Keyword.Span()
+	c.expression(stmt.Condition)
+
+	thenJump := c.emitJump(span, opJumpIfFalse)
+	c.emit(span, byte(opPop))
+	c.statement(stmt.ThenBranch)
+
+	elseJump := c.emitJump(span, opJump)
+	c.patchJump(span, thenJump)
+	c.emit(span, byte(opPop))
+
+	if stmt.ElseBranch != nil {
+		c.statement(stmt.ElseBranch)
+	}
+	c.patchJump(span, elseJump)
+	return nil
+}
+
+func (c *compiler) VisitWhileStmt(stmt statements.WhileStmt) error {
+	span := stmt.Keyword.Span()
+	loopStart := len(c.chunk().code)
+	c.expression(stmt.Condition)
+
+	exitJump := c.emitJump(span, opJumpIfFalse)
+	c.emit(span, byte(opPop))
+
+	l := &loop{scopeDepth: c.current.scopeDepth}
+	c.current.loops = append(c.current.loops, l)
+	c.statement(stmt.Body)
+	c.current.loops = c.current.loops[:len(c.current.loops)-1]
+
+	for _, jump := range l.continueJumps {
+		c.patchJump(span, jump)
+	}
+	if stmt.Increment != nil {
+		c.expression(stmt.Increment)
+		c.emit(span, byte(opPop))
+	}
+	c.emitLoop(span, loopStart)
+
+	c.patchJump(span, exitJump)
+	c.emit(span, byte(opPop))
+	for _, jump := range l.breakJumps {
+		c.patchJump(span, jump)
+	}
+	return nil
+}
+
+// discardLoopLocals pops the locals declared inside the loop body without
+// forgetting them, since compilation of the body carries on after the jump.
+func (c *compiler) discardLoopLocals(span tokens.Span, l *loop) {
+	fc := c.current
+	for n := len(fc.locals) - 1; n >= 0 && fc.locals[n].depth > l.scopeDepth; n-- {
+		if fc.locals[n].isCaptured {
+			c.emit(span, byte(opCloseUpvalue))
+		} else {
+			c.emit(span, byte(opPop))
+		}
+	}
+}
+
+func (c *compiler) VisitBreakStmt(stmt statements.BreakStmt) error {
+	l := c.current.loops[len(c.current.loops)-1]
+	c.exitHandlers(stmt.Span(), len(c.current.loops))
+	c.discardLoopLocals(stmt.Span(), l)
+	l.breakJumps = append(l.breakJumps, c.emitJump(stmt.Span(), opJump))
+	return nil
+}
+
+func (c *compiler) VisitContinueStmt(stmt statements.ContinueStmt) error {
+	l := c.current.loops[len(c.current.loops)-1]
+	c.exitHandlers(stmt.Span(), len(c.current.loops))
+	c.discardLoopLocals(stmt.Span(), l)
+	l.continueJumps = append(l.continueJumps, c.emitJump(stmt.Span(), opJump))
+	return nil
+}
+
+func (c *compiler) VisitBinary(expr expressions.Binary) (interface{}, error) {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+
+	span := expr.Operator.Span()
+	switch expr.Operator.TokenType {
+	case tokens.BANG_EQUAL:
+		c.emit(span, byte(opEqual), byte(opNot))
+	case tokens.EQUAL_EQUAL:
+		c.emit(span, byte(opEqual))
+	case tokens.GREATER:
+		c.emit(span, byte(opGreater))
+	case tokens.GREATER_EQUAL:
+		c.emit(span, byte(opGreaterEqual))
+	case tokens.LESS:
+		c.emit(span, byte(opLess))
+	case tokens.LESS_EQUAL:
+		c.emit(span, byte(opLessEqual))
+	case tokens.PLUS:
+		c.emit(span, byte(opAdd))
+	case tokens.MINUS:
+		c.emit(span, byte(opSubtract))
+	case tokens.STAR:
+		c.emit(span, byte(opMultiply))
+	case tokens.SLASH:
+		c.emit(span, byte(opDivide))
+	}
+	return nil, nil
+}
+
+func (c *compiler) VisitGrouping(expr expressions.Grouping) (interface{}, error) {
+	c.expression(expr.Expression)
+	return nil, nil
+}
+
+func (c *compiler) VisitLiteral(expr expressions.Literal) (interface{}, error) {
+	span := expr.Span()
+	switch expr.Value {
+	case nil:
+		c.emit(span, byte(opNil))
+	case true:
+		c.emit(span, byte(opTrue))
+	case false:
+		c.emit(span, byte(opFalse))
+	default:
+		c.emitConstant(span, expr.Value)
+	}
+	return nil, nil
+}
+
+func (c *compiler) VisitUnary(expr expressions.Unary) (interface{}, error) {
+	c.expression(expr.Right)
+
+	span := expr.Operator.Span()
+	switch expr.Operator.TokenType {
+	case tokens.BANG:
+		c.emit(span, byte(opNot))
+	case tokens.MINUS:
+		c.emit(span, byte(opNegate))
+	}
+	return nil, nil
+}
+
+func (c *compiler) VisitVariable(expr expressions.Variable) (interface{}, error) {
+	c.namedVariable(expr.Name, nil)
+	return nil, nil
+}
+
+func (c *compiler) VisitAssign(expr expressions.Assign) (interface{}, error) {
+	c.namedVariable(expr.Name, expr.Value)
+	return nil, nil
+}
+
+func (c *compiler) VisitLogical(expr expressions.Logical) (interface{}, error) {
+	span := expr.Operator.Span()
+	c.expression(expr.Left)
+
+	if expr.Operator.TokenType == tokens.OR {
+		elseJump := c.emitJump(span, opJumpIfFalse)
+		endJump := c.emitJump(span, opJump)
+		c.patchJump(span, elseJump)
+		c.emit(span, byte(opPop))
+		c.expression(expr.Right)
+		c.patchJump(span, endJump)
+		return nil, nil
+	}
+
+	endJump := c.emitJump(span, opJumpIfFalse)
+	c.emit(span, byte(opPop))
+	c.expression(expr.Right)
+	c.patchJump(span, endJump)
+	return nil, nil
+}
+
+func (c *compiler) VisitCall(expr expressions.Call) (interface{}, error) {
+	c.expression(expr.Callee)
+	for _, arg := range expr.Arguments {
+		c.expression(arg)
+	}
+	c.emit(expr.Span(), byte(opCall), byte(len(expr.Arguments)))
+	return nil, nil
+}
+
+func (c *compiler) VisitGet(expr expressions.Get) (interface{}, error) {
+	c.expression(expr.Object)
+	c.emitShort(expr.Name.Span(), opGetProperty, c.identifierConstant(expr.Name))
+	return nil, nil
+}
+
+func (c *compiler) VisitSet(expr expressions.Set) (interface{}, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Value)
+	c.emitShort(expr.Name.Span(), opSetProperty, c.identifierConstant(expr.Name))
+	return nil, nil
+}
+
+func (c *compiler) VisitThis(expr expressions.This) (interface{}, error) {
+	c.namedVariable(expr.Keyword, nil)
+	return nil, nil
+}
+
+func (c *compiler) VisitSuper(expr expressions.Super) (interface{}, error) {
+	c.namedVariable(thisToken, nil)
+	c.namedVariable(expr.Keyword, nil)
+	c.emitShort(expr.Method.Span(), opGetSuper, c.identifierConstant(expr.Method))
+	return nil, nil
+}
+
+func (c *compiler) VisitList(expr expressions.List) (interface{}, error) {
+	for _, element := range expr.Elements {
+		c.expression(element)
+	}
+	if len(expr.Elements) > math.MaxUint16 {
+		c.error(expr.Span(), "Too many elements in list literal.")
+	}
+	c.emitShort(expr.Span(), opBuildList, len(expr.Elements))
+	return nil, nil
+}
+
+func (c *compiler) VisitIndex(expr expressions.Index) (interface{}, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Index)
+	c.emit(expr.Span(), byte(opGetIndex))
+	return nil, nil
+}
+
+func (c *compiler) VisitSetIndex(expr expressions.SetIndex) (interface{}, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Index)
+	c.expression(expr.Value)
+	c.emit(expr.Span(), byte(opSetIndex))
+	return nil, nil
+}
+
+func (c *compiler) VisitMap(expr expressions.Map) (interface{}, error) {
+	for n := range expr.Keys {
+		c.expression(expr.Keys[n])
+		c.expression(expr.Values[n])
+	}
+	if len(expr.Keys) > math.MaxUint16 {
+		c.error(expr.Span(), "Too many entries in map literal.")
+	}
+	c.emitShort(expr.Span(), opBuildMap, len(expr.Keys))
+	return nil, nil
+}
+
+func (c *compiler) VisitThrowStmt(stmt statements.ThrowStmt) error {
+	c.expression(stmt.Value)
+	c.emit(stmt.Span(), byte(opThrow))
+	return nil
+}
+
+// VisitTryStmt lays out the code caught errors take ahead of the normal exit,
+// so that both paths end by falling into the finally block, if there is one:
+//
+//	push handler -> catch; body; pop handler; jump -> exit
+//	catch:   push handler -> finally; catch body; pop handler; jump -> exit
+//	finally: finally block; rethrow
+//	exit:    finally block
+func (c *compiler) VisitTryStmt(stmt statements.TryStmt) error {
+	span := stmt.Keyword.Span()
+	fc := c.current
+	scope := handlerScope{finally: stmt.Finally, loops: len(fc.loops)}
+
+	handler := c.emitJump(span, opPushHandler)
+	fc.handlers = append(fc.handlers, scope)
+	c.statement(stmt.Body)
+	fc.handlers = fc.handlers[:len(fc.handlers)-1]
+	c.emit(span, byte(opPopHandler))
+	exitJumps := []int{c.emitJump(span, opJump)}
+	c.patchJump(span, handler)
+
+	// the vm pushes the caught error into the slot of a new local
+	if stmt.Catch != nil {
+		c.beginScope()
+		c.addLocal(stmt.Catch.Name)
+		c.markInitialized()
+		c.emit(stmt.Catch.Keyword.Span(), byte(opCatch))
+		if stmt.Finally != nil {
+			handler = c.emitJump(span, opPushHandler)
+			fc.handlers = append(fc.handlers, scope)
+		}
+		for _, s := range stmt.Catch.Body {
+			c.statement(s)
+		}
+		if stmt.Finally != nil {
+			fc.handlers = fc.handlers[:len(fc.handlers)-1]
+			c.emit(span, byte(opPopHandler))
+		}
+		c.endScope(span)
+
+		if stmt.Finally != nil {
+			exitJumps = append(exitJumps, c.emitJump(span, opJump))
+			c.patchJump(span, handler)
+		}
+	}
+
+	if stmt.Finally != nil {
+		// the error stays in a nameless local until it is raised again
+		c.beginScope()
+		c.addLocal(tokens.Token{})
+		c.markInitialized()
+		c.statement(*stmt.Finally)
+		c.emit(span, byte(opThrow))
+		fc.scopeDepth--
+		fc.locals = fc.locals[:len(fc.locals)-1]
+	}
+
+	for _, jump := range exitJumps {
+		c.patchJump(span, jump)
+	}
+	if stmt.Finally != nil {
+		c.statement(*stmt.Finally)
+	}
+	return nil
+}
+
+// exitHandlers emits the cleanup for a jump out of the try statements opened
+// inside the given number of enclosing loops, innermost first.
+func (c *compiler) exitHandlers(span tokens.Span, loops int) {
+	fc := c.current
+	handlers := fc.handlers
+	for n := len(handlers) - 1; n >= 0 && handlers[n].loops >= loops; n-- {
+		// a jump inside the finally block only has the outer handlers left to exit
+		fc.handlers = handlers[:n]
+		c.emit(span, byte(opPopHandler))
+		if handlers[n].finally != nil {
+			c.statement(*handlers[n].finally)
+		}
+	}
+	fc.handlers = handlers
+}
+
+func (c *compiler) VisitImportStmt(stmt statements.ImportStmt) error {
+	span := stmt.Span()
+	c.emitShort(span, opImport, c.makeConstant(span, stmt.Path.Literal.(string)))
+	if stmt.Name != nil {
+		c.defineVariable(*stmt.Name)
+	} else {
+		c.emit(span, byte(opImportAll))
+	}
+	return nil
+}
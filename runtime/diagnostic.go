@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+// Category is the phase of the runtime an error was found in.
+type Category int
+
+const (
+	CategoryScan Category = iota
+	CategoryParse
+	CategoryResolve
+	CategoryCompile
+	CategoryRuntime
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategoryScan:
+		return "scan"
+	case CategoryParse:
+		return "parse"
+	case CategoryResolve:
+		return "resolve"
+	case CategoryCompile:
+		return "compile"
+	case CategoryRuntime:
+		return "runtime"
+	}
+	return "unknown"
+}
+
+// Diagnostic is a single error found in a Lox program.
+type Diagnostic struct {
+	Category Category
+	Span     tokens.Span
+	Message  string
+	Hints    []string
+	Trace    []StackFrame // only set for runtime errors raised inside a call
+}
+
+// sourceRecorder is implemented by reporters that want the source text
+// of everything evaluated, to show excerpts next to their diagnostics.
+type sourceRecorder interface {
+	AddSource(file string, src string)
+}
+
+// diagnosticRenderer prints diagnostics with an excerpt of the offending source:
+//
+//	runtime error: Operand must be a number.
+//	 --> script.lx:3:7
+//	  |
+//	3 | print -"a";
+//	  |       ^
+//	  = hint: ...
+type diagnosticRenderer struct {
+	color   bool
+	sources map[string]string
+}
+
+func newDiagnosticRenderer(color bool) *diagnosticRenderer {
+	return &diagnosticRenderer{
+		color:   color,
+		sources: make(map[string]string),
+	}
+}
+
+func (r *diagnosticRenderer) AddSource(file string, src string) {
+	r.sources[file] = src
+}
+
+func (r *diagnosticRenderer) paint(color string, s string) string {
+	return paint(r.color, color, s)
+}
+
+func (r *diagnosticRenderer) render(w io.Writer, d Diagnostic) {
+	header := fmt.Sprintf("%s error:", d.Category)
+	fmt.Fprintf(w, "%s %s\n", r.paint(RED, header), d.Message)
+
+	start := d.Span.Start
+	if start.Line == 0 {
+		// synthesized by the runtime, nothing to point at
+		r.renderHints(w, "", d.Hints)
+		r.renderTrace(w, "", d.Trace)
+		return
+	}
+
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.Line)))
+	fmt.Fprintf(w, "%s%s %s\n", gutter, r.paint(BLUE, "-->"), start)
+
+	line, ok := r.sourceLine(start)
+	if !ok {
+		r.renderHints(w, gutter, d.Hints)
+		r.renderTrace(w, gutter, d.Trace)
+		return
+	}
+
+	bar := r.paint(BLUE, "|")
+	fmt.Fprintf(w, "%s %s\n", gutter, bar)
+	fmt.Fprintf(w, "%s %s %s\n", r.paint(BLUE, fmt.Sprint(start.Line)), bar, line)
+	fmt.Fprintf(w, "%s %s %s%s\n", gutter, bar, caretIndent(line, start.Column), r.paint(RED, carets(line, d.Span)))
+
+	r.renderHints(w, gutter, d.Hints)
+	r.renderTrace(w, gutter, d.Trace)
+}
+
+func (r *diagnosticRenderer) renderHints(w io.Writer, gutter string, hints []string) {
+	for _, hint := range hints {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint(BLUE, "="), "hint: "+hint)
+	}
+}
+
+// maxTraceFrames bounds the frames rendered, so a stack overflow shows only the deepest calls.
+const maxTraceFrames = 20
+
+func (r *diagnosticRenderer) renderTrace(w io.Writer, gutter string, trace []StackFrame) {
+	if len(trace) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s %s stack trace:\n", gutter, r.paint(BLUE, "="))
+	for n, frame := range trace {
+		if n == maxTraceFrames {
+			fmt.Fprintf(w, "%s     ... %d more\n", gutter, len(trace)-n)
+			break
+		}
+		fmt.Fprintf(w, "%s     %s\n", gutter, frame)
+	}
+}
+
+// sourceLine returns the full line of source containing the position.
+func (r *diagnosticRenderer) sourceLine(pos tokens.Position) (string, bool) {
+	src, ok := r.sources[pos.File]
+	if !ok || pos.Offset > len(src) {
+		return "", false
+	}
+
+	start := strings.LastIndexByte(src[:pos.Offset], '\n') + 1
+	end := strings.IndexByte(src[pos.Offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += pos.Offset
+	}
+	return strings.TrimRight(src[start:end], "\r"), true
+}
+
+// caretIndent lines the carets up under the given column, keeping tabs so they align.
+func caretIndent(line string, column int) string {
+	indent := strings.Builder{}
+	for i, c := range []rune(line) {
+		if i >= column-1 {
+			break
+		}
+		if c == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	return indent.String()
+}
+
+// carets underlines the span, stopping at the end of the line for spans covering several lines.
+func carets(line string, span tokens.Span) string {
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line {
+		width = len([]rune(line)) - span.Start.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+	return strings.Repeat("^", width)
+}
@@ -1,38 +1,23 @@
 package runtime
 
 import (
-	"errors"
-	"fmt"
-
 	"github.com/awgraves/go-lox/tokens"
 )
 
-type Environment interface {
-	define(name string, value interface{})
-	get(name tokens.Token) (interface{}, error)
-	getAt(distance int, name tokens.Token) (interface{}, error)
-	assign(name tokens.Token, value interface{}) error
-	assignAt(distance int, name tokens.Token, value interface{}) error
-	getEnclosing() Environment
-}
-
+// environment holds the global variables of a script or module, looked up by name.
+// Its enclosing environment holds the builtins.
 type environment struct {
-	enclosing   Environment
-	values      map[string]interface{}
-	errReporter ErrorReporter
+	enclosing *environment
+	values    map[string]interface{}
 }
 
-func newEnvironment(enclosing Environment) *environment {
+func newEnvironment(enclosing *environment) *environment {
 	return &environment{
 		enclosing: enclosing,
 		values:    make(map[string]interface{}),
 	}
 }
 
-func (e *environment) getEnclosing() Environment {
-	return e.enclosing
-}
-
 func (e *environment) define(name string, value interface{}) {
 	e.values[name] = value
 }
@@ -43,33 +28,19 @@ func (e *environment) get(name tokens.Token) (interface{}, error) {
 		if e.enclosing != nil {
 			return e.enclosing.get(name)
 		}
-		err := errors.New(fmt.Sprintf("Undefined variable '%s' when getting.", name))
+		err := newRuntimeError(name.Span(), "Undefined variable '%s' when getting.", name)
 		return nil, err
 	}
 	return val, nil
 }
 
-func (e *environment) getAt(distance int, name tokens.Token) (interface{}, error) {
-	env := e.ancestor(distance)
-	return env.get(name)
-}
-
-func (e *environment) ancestor(distance int) Environment {
-	var env Environment = e
-	for i := 0; i < distance; i++ {
-		env = env.getEnclosing()
-	}
-
-	return env
-}
-
 func (e *environment) assign(name tokens.Token, value interface{}) error {
 	_, ok := e.values[name.Lexeme]
 	if !ok {
 		if e.enclosing != nil {
-			e.enclosing.assign(name, value)
+			return e.enclosing.assign(name, value)
 		}
-		err := errors.New(fmt.Sprintf("Undefined variable '%s' when assigning.", name))
+		err := newRuntimeError(name.Span(), "Undefined variable '%s' when assigning.", name)
 		return err
 	}
 
@@ -77,7 +48,38 @@ func (e *environment) assign(name tokens.Token, value interface{}) error {
 	return nil
 }
 
-func (e *environment) assignAt(distance int, name tokens.Token, value interface{}) error {
-	env := e.ancestor(distance)
-	return env.assign(name, value)
+// localEnvironment holds the variables of a block, function call or catch clause.
+// Variables are stored in the order they are defined, which is the order the
+// resolver handed out their slots in, so they are read and written by index.
+type localEnvironment struct {
+	enclosing *localEnvironment // nil when enclosed by the globals
+	values    []interface{}
+}
+
+func newLocalEnvironment(enclosing *localEnvironment, size int) *localEnvironment {
+	return &localEnvironment{
+		enclosing: enclosing,
+		values:    make([]interface{}, 0, size),
+	}
+}
+
+// define puts the value in the next free slot.
+func (e *localEnvironment) define(value interface{}) {
+	e.values = append(e.values, value)
+}
+
+func (e *localEnvironment) ancestor(distance int) *localEnvironment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
+}
+
+func (e *localEnvironment) getAt(distance int, slot int) interface{} {
+	return e.ancestor(distance).values[slot]
+}
+
+func (e *localEnvironment) assignAt(distance int, slot int, value interface{}) {
+	e.ancestor(distance).values[slot] = value
 }
@@ -1,40 +1,140 @@
 package runtime
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
 
-func printError(message string) {
-	fmt.Print(RED)
-	fmt.Println(message)
-	fmt.Print(RESET_COLOR)
+	"github.com/awgraves/go-lox/tokens"
+)
+
+func printError(w io.Writer, color bool, message string) {
+	fmt.Fprintln(w, paint(color, RED, message))
+}
+
+// StackFrame is one active call at the time of a runtime error.
+type StackFrame struct {
+	Function string
+	CallSite tokens.Span
+}
+
+func (f StackFrame) String() string {
+	return fmt.Sprintf("%s called at %s", f.Function, f.CallSite.Start)
+}
+
+// RuntimeError is raised while executing a program.
+// Span locates the node that caused it and Trace lists the calls
+// that were active when it was raised, innermost first.
+type RuntimeError struct {
+	Span    tokens.Span
+	Message string
+	Trace   []StackFrame
+
+	thrown bool  // raised by a throw statement rather than the runtime
+	value  Value // the thrown value
+	err    error // sentinel the error wraps, if any
+}
+
+func newRuntimeError(span tokens.Span, format string, args ...interface{}) *RuntimeError {
+	return &RuntimeError{Span: span, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.err
+}
+
+// stackOverflow is the error raised by a call nested too deeply.
+func stackOverflow(span tokens.Span, trace []StackFrame) *RuntimeError {
+	err := newRuntimeError(span, "Stack overflow.")
+	err.Trace = trace
+	err.err = ErrStackOverflow
+	return err
+}
+
+// stopsProgram reports whether the error ends the whole program instead of
+// being a runtime error the script could catch.
+func stopsProgram(err error) bool {
+	var abortErr *AbortError
+	var exitErr *ExitError
+	return errors.As(err, &abortErr) || errors.As(err, &exitErr)
+}
+
+func runtimeDiagnostic(err error) Diagnostic {
+	d := Diagnostic{Category: CategoryRuntime, Message: err.Error()}
+
+	var runtimeErr *RuntimeError
+	var abortErr *AbortError
+	if errors.As(err, &runtimeErr) {
+		d.Span = runtimeErr.Span
+		d.Message = runtimeErr.Message
+		d.Trace = runtimeErr.Trace
+	} else if errors.As(err, &abortErr) {
+		d.Span = abortErr.Span
+	}
+	return d
+}
+
+// resolveError is a static error found by the resolver.
+type resolveError struct {
+	span    tokens.Span
+	message string
+	hints   []string
+}
+
+func newResolveError(span tokens.Span, message string, hints ...string) *resolveError {
+	return &resolveError{span: span, message: message, hints: hints}
+}
+
+func (e *resolveError) Error() string {
+	return e.message
 }
 
 type ErrorReporter interface {
-	AddError(lineNum int, charIdx int, message string)
+	AddError(d Diagnostic)
 	HasError() bool
 	Report()
+	Reset()
 }
 
 type basicErrorReporter struct {
-	errorMsgs []string
+	diagnostics []Diagnostic
+	renderer    *diagnosticRenderer
+	w           io.Writer // where Report renders the diagnostics
 }
 
-func newBasicErrorReporter() *basicErrorReporter {
+func newBasicErrorReporter(w io.Writer, color bool) *basicErrorReporter {
 	return &basicErrorReporter{
-		errorMsgs: []string{},
+		diagnostics: []Diagnostic{},
+		renderer:    newDiagnosticRenderer(color),
+		w:           w,
 	}
 }
 
-func (b *basicErrorReporter) AddError(lineNum int, charIdx int, message string) {
-	m := fmt.Sprintf("[line %d pos %d] Error: %s", lineNum, charIdx, message)
-	b.errorMsgs = append(b.errorMsgs, m)
+func (b *basicErrorReporter) AddError(d Diagnostic) {
+	b.diagnostics = append(b.diagnostics, d)
+}
+
+func (b *basicErrorReporter) AddSource(file string, src string) {
+	b.renderer.AddSource(file, src)
 }
 
 func (b *basicErrorReporter) HasError() bool {
-	return len(b.errorMsgs) > 0
+	return len(b.diagnostics) > 0
 }
 
 func (b *basicErrorReporter) Report() {
-	for _, m := range b.errorMsgs {
-		printError(m)
+	for i, d := range b.diagnostics {
+		if i > 0 {
+			fmt.Fprintln(b.w)
+		}
+		b.renderer.render(b.w, d)
 	}
 }
+
+func (b *basicErrorReporter) Reset() {
+	b.diagnostics = []Diagnostic{}
+}
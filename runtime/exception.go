@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+// LoxError is the value a catch clause receives for an error raised by the runtime.
+// Scripts read it through the properties message, line, column and file.
+type LoxError struct {
+	Message string
+	Span    tokens.Span
+	Trace   []StackFrame
+}
+
+func (e *LoxError) String() string {
+	return fmt.Sprintf("<error %s>", e.Message)
+}
+
+func (e *LoxError) get(name string) (Value, error) {
+	switch name {
+	case "message":
+		return e.Message, nil
+	case "line":
+		return float64(e.Span.Start.Line), nil
+	case "column":
+		return float64(e.Span.Start.Column), nil
+	case "file":
+		return e.Span.Start.File, nil
+	}
+	return nil, fmt.Errorf("Undefined property '%s'.", name)
+}
+
+// caughtValue is what a catch clause binds for the error: the thrown value
+// for a throw statement, otherwise a LoxError describing the runtime error.
+func caughtValue(err *RuntimeError) Value {
+	if err.thrown {
+		return err.value
+	}
+	return &LoxError{Message: err.Message, Span: err.Span, Trace: err.Trace}
+}
+
+// throwError builds the error raised by a throw statement. Throwing a caught
+// LoxError raises the original error again, keeping its position and trace.
+func throwError(span tokens.Span, value Value) *RuntimeError {
+	if e, ok := value.(*LoxError); ok {
+		return &RuntimeError{Span: e.Span, Message: e.Message, Trace: e.Trace}
+	}
+	err := newRuntimeError(span, "Uncaught exception: %s.", stringify(value))
+	err.thrown = true
+	err.value = value
+	return err
+}
@@ -3,6 +3,7 @@ package runtime
 import (
 	"errors"
 	"fmt"
+	"io"
 
 	"github.com/awgraves/go-lox/expressions"
 	"github.com/awgraves/go-lox/statements"
@@ -11,40 +12,70 @@ import (
 
 type interpreter struct {
 	errReporter ErrorReporter
-	globals     Environment
-	environment Environment
-	locals      map[expressions.Expression]int
+	builtins    *environment      // natives, shared by the script and every module
+	globals     *environment      // of the script or module whose code is executing
+	environment *localEnvironment // nil at the top level, where variables are globals
+	callStack   []StackFrame
+	modules     *moduleLoader
+	limits      *limits
+	tracer      *tracer
+	stdout      io.Writer // where print writes
 }
 
-func newIntepreter(errReporter ErrorReporter) *interpreter {
-	globals := newEnvironment(nil)
-	globals.define("clock", Clock{})
+func newIntepreter(errReporter ErrorReporter, modules *moduleLoader, limits *limits, tracer *tracer, stdout io.Writer) *interpreter {
+	builtins := newEnvironment(nil)
+	globals := newEnvironment(builtins)
 
 	return &interpreter{
 		errReporter: errReporter,
+		builtins:    builtins,
 		globals:     globals,
-		environment: globals,
-		locals:      make(map[expressions.Expression]int),
+		modules:     modules,
+		limits:      limits,
+		tracer:      tracer,
+		stdout:      stdout,
 	}
 }
 
-func (i *interpreter) interpret(statements []statements.Stmt) {
-	for _, s := range statements {
-		err := i.execute(s)
+// interpret executes the statements in order, stopping at the first runtime error.
+// The value of a trailing expression statement is returned.
+func (i *interpreter) interpret(stmts []statements.Stmt) (interface{}, error) {
+	var value interface{}
+	for _, s := range stmts {
+		var err error
+		if exp, ok := s.(statements.ExpStmt); ok {
+			value, err = i.evaluate(exp.Expression)
+		} else {
+			value, err = nil, i.execute(s)
+		}
 		if err != nil {
-			//TODO: make this accurate
-			i.errReporter.AddError(0, 0, err.Error())
-			return
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) {
+				i.errReporter.AddError(runtimeDiagnostic(err))
+			}
+			return nil, err
 		}
 	}
+	return value, nil
 }
 
 func (i *interpreter) execute(stmt statements.Stmt) error {
+	if err := i.limits.step(); err != nil {
+		return &AbortError{Span: stmt.Span(), Err: err}
+	}
+	if i.tracer != nil {
+		i.tracer.emit(PhaseInterpret, "execute", stmt.Span(), map[string]interface{}{"kind": statementKind(stmt)})
+	}
 	return stmt.Accept(i)
 }
 
-func (i *interpreter) resolve(expr expressions.Expression, depth int) {
-	i.locals[expr] = depth
+// define binds a new variable in the innermost scope.
+func (i *interpreter) define(name string, value interface{}) {
+	if i.environment == nil {
+		i.globals.define(name, value)
+		return
+	}
+	i.environment.define(value)
 }
 
 func stringify(v interface{}) string {
@@ -65,10 +96,10 @@ func (i *interpreter) VisitVarStmt(stmt statements.VarStmt) error {
 		if err != nil {
 			return err
 		}
-		i.environment.define(stmt.Name.Lexeme, value)
+		i.define(stmt.Name.Lexeme, value)
 		return nil
 	}
-	i.environment.define(stmt.Name.Lexeme, nil)
+	i.define(stmt.Name.Lexeme, nil)
 	return nil
 }
 
@@ -77,11 +108,20 @@ func (i *interpreter) VisitWhileStmt(stmt statements.WhileStmt) error {
 	if err != nil {
 		return err
 	}
-	for i.isTruthy(res) {
+	for isTruthy(res) {
 		err = i.execute(stmt.Body)
-		if err != nil {
+		if _, ok := err.(*breakSignal); ok {
+			return nil
+		}
+		if _, ok := err.(*continueSignal); !ok && err != nil {
 			return err
 		}
+		if stmt.Increment != nil {
+			_, err = i.evaluate(stmt.Increment)
+			if err != nil {
+				return err
+			}
+		}
 		res, err = i.evaluate(stmt.Condition)
 		if err != nil {
 			return err
@@ -96,33 +136,29 @@ func (i *interpreter) VisitAssign(expr expressions.Assign) (interface{}, error)
 		return nil, err
 	}
 
-	distance, ok := i.locals[expr]
-	if ok {
-		err = i.environment.assignAt(distance, expr.Name, value)
-	} else {
-		err = i.globals.assign(expr.Name, value)
+	if local := expr.Binding; local.Resolved {
+		i.environment.assignAt(local.Depth, local.Slot, value)
+		return value, nil
 	}
-	return value, err
+	return value, i.globals.assign(expr.Name, value)
 }
 
 func (i *interpreter) VisitVariable(expr expressions.Variable) (interface{}, error) {
-	return i.lookUpVariable(expr.Name, expr)
+	return i.lookUpVariable(expr.Name, expr.Binding)
 }
 
-func (i *interpreter) lookUpVariable(name tokens.Token, expr expressions.Expression) (interface{}, error) {
-	distance, ok := i.locals[expr]
-	if ok {
-		return i.environment.getAt(distance, name)
-	} else {
-		return i.globals.get(name)
+func (i *interpreter) lookUpVariable(name tokens.Token, local *expressions.Binding) (interface{}, error) {
+	if local.Resolved {
+		return i.environment.getAt(local.Depth, local.Slot), nil
 	}
+	return i.globals.get(name)
 }
 
 func (i *interpreter) VisitBlock(stmt statements.Block) error {
-	return i.executeBlock(stmt.Statements, newEnvironment(i.environment))
+	return i.executeBlock(stmt.Statements, newLocalEnvironment(i.environment, 0))
 }
 
-func (i *interpreter) executeBlock(statements []statements.Stmt, environment Environment) error {
+func (i *interpreter) executeBlock(statements []statements.Stmt, environment *localEnvironment) error {
 	previous := i.environment
 	i.environment = environment
 	for _, statement := range statements {
@@ -141,9 +177,50 @@ func (i *interpreter) VisitExpressionStmt(stmt statements.ExpStmt) error {
 	return err
 }
 
+func (i *interpreter) VisitClassStmt(stmt statements.ClassStmt) error {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		value, err := i.evaluate(*stmt.Superclass)
+		if err != nil {
+			return err
+		}
+
+		class, ok := value.(*LoxClass)
+		if !ok {
+			return newRuntimeError(stmt.Superclass.Span(), "Superclass must be a class.")
+		}
+		superclass = class
+	}
+
+	if superclass != nil {
+		i.environment = newLocalEnvironment(i.environment, 1)
+		i.environment.define(superclass)
+	}
+
+	methods := make(map[string]*LoxFunction)
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = &LoxFunction{
+			Closure:       i.environment,
+			Declaration:   method,
+			isInitializer: method.Name.Lexeme == "init",
+			globals:       i.globals,
+		}
+	}
+
+	class := &LoxClass{Name: stmt.Name.Lexeme, Superclass: superclass, Methods: methods}
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	// methods can only run once the class exists, so it can be defined last
+	i.define(stmt.Name.Lexeme, class)
+	return nil
+}
+
 func (i *interpreter) VisitFunctionStmt(stmt statements.FunctionStmt) error {
-	function := LoxFunction{Closure: i.environment, Declaration: stmt}
-	i.environment.define(stmt.Name.Lexeme, function)
+	function := &LoxFunction{Closure: i.environment, Declaration: stmt, globals: i.globals}
+	i.define(stmt.Name.Lexeme, function)
 	return nil
 }
 
@@ -152,7 +229,7 @@ func (i *interpreter) VisitIfStmt(stmt statements.IfStmt) error {
 	if err != nil {
 		return err
 	}
-	if i.isTruthy(res) {
+	if isTruthy(res) {
 		err = i.execute(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
 		err = i.execute(stmt.ElseBranch)
@@ -165,7 +242,7 @@ func (i *interpreter) VisitPrintStmt(stmt statements.PrintStmt) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(stringify(value))
+	fmt.Fprintln(i.stdout, stringify(value))
 	return nil
 }
 
@@ -177,6 +254,104 @@ func (r *ReturnValue) Error() string {
 	return "Return Value"
 }
 
+// breakSignal and continueSignal unwind execution to the innermost loop,
+// the same way ReturnValue unwinds to the enclosing call.
+type breakSignal struct{}
+
+func (b *breakSignal) Error() string {
+	return "Break"
+}
+
+type continueSignal struct{}
+
+func (c *continueSignal) Error() string {
+	return "Continue"
+}
+
+func (i *interpreter) VisitBreakStmt(stmt statements.BreakStmt) error {
+	return &breakSignal{}
+}
+
+func (i *interpreter) VisitContinueStmt(stmt statements.ContinueStmt) error {
+	return &continueSignal{}
+}
+
+func (i *interpreter) VisitThrowStmt(stmt statements.ThrowStmt) error {
+	value, err := i.evaluate(stmt.Value)
+	if err != nil {
+		return err
+	}
+	return throwError(stmt.Span(), value)
+}
+
+// VisitTryStmt catches runtime errors only; returns, breaks and continues
+// pass through, though the finally block still runs on the way out.
+func (i *interpreter) VisitTryStmt(stmt statements.TryStmt) error {
+	err := i.execute(stmt.Body)
+
+	var runtimeErr *RuntimeError
+	if stmt.Catch != nil && errors.As(err, &runtimeErr) {
+		environment := newLocalEnvironment(i.environment, 1)
+		environment.define(caughtValue(runtimeErr))
+		err = i.executeBlock(stmt.Catch.Body, environment)
+	}
+
+	// an aborted or exited program stops at once, as it does on the vm
+	if stmt.Finally != nil && !stopsProgram(err) {
+		if finallyErr := i.execute(*stmt.Finally); finallyErr != nil {
+			return finallyErr
+		}
+	}
+	return err
+}
+
+func (i *interpreter) VisitImportStmt(stmt statements.ImportStmt) error {
+	module, err := i.modules.load(stmt.Path.Literal.(string), stmt.Span())
+	if err != nil {
+		var runtimeErr *RuntimeError
+		if errors.As(err, &runtimeErr) || stopsProgram(err) {
+			return err
+		}
+		runtimeErr = newRuntimeError(stmt.Span(), "%s", err.Error())
+		runtimeErr.Trace = i.trace()
+		return runtimeErr
+	}
+
+	if stmt.Name != nil {
+		i.globals.define(stmt.Name.Lexeme, module)
+		return nil
+	}
+	for name, value := range module.values {
+		i.globals.define(name, value)
+	}
+	return nil
+}
+
+// runModule executes a module's statements in fresh globals and returns them.
+// The module is on the call stack while it runs, as it is on the vm,
+// so errors raised in it are traced back to the import.
+func (i *interpreter) runModule(stmts []statements.Stmt, frame StackFrame) (map[string]Value, error) {
+	globals := newEnvironment(i.builtins)
+	previousGlobals, previous := i.globals, i.environment
+	i.globals, i.environment = globals, nil
+	i.callStack = append(i.callStack, frame)
+
+	var err error
+	for _, stmt := range stmts {
+		if err = i.execute(stmt); err != nil {
+			break
+		}
+	}
+
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) && runtimeErr.Trace == nil {
+		runtimeErr.Trace = i.trace()
+	}
+	i.callStack = i.callStack[:len(i.callStack)-1]
+	i.globals, i.environment = previousGlobals, previous
+	return globals.values, err
+}
+
 func (i *interpreter) VisitReturnStmt(stmt statements.ReturnStmt) error {
 	if stmt.Value != nil {
 		val, err := i.evaluate(stmt.Value)
@@ -199,11 +374,11 @@ func (i *interpreter) VisitLogical(exp expressions.Logical) (interface{}, error)
 	}
 
 	if exp.Operator.TokenType == tokens.OR {
-		if i.isTruthy(left) {
+		if isTruthy(left) {
 			return left, nil
 		}
 	} else {
-		if !i.isTruthy(left) {
+		if !isTruthy(left) {
 			return left, nil
 		}
 	}
@@ -219,10 +394,10 @@ func (i *interpreter) evaluate(exp expressions.Expression) (interface{}, error)
 	return exp.Accept(i)
 }
 
-func castToFloat(i interface{}) (float64, error) {
+func castToFloat(operator tokens.Token, i interface{}) (float64, error) {
 	num, ok := i.(float64)
 	if !ok {
-		return 0, errors.New("Operand must be a number")
+		return 0, newRuntimeError(operator.Span(), "Operand must be a number.")
 	}
 	return num, nil
 }
@@ -235,9 +410,9 @@ func (i *interpreter) VisitUnary(exp expressions.Unary) (interface{}, error) {
 
 	switch exp.Operator.TokenType {
 	case tokens.BANG:
-		return !i.isTruthy(right), nil
+		return !isTruthy(right), nil
 	case tokens.MINUS:
-		num, err := castToFloat(right)
+		num, err := castToFloat(exp.Operator, right)
 		if err != nil {
 			return nil, err
 		}
@@ -245,10 +420,10 @@ func (i *interpreter) VisitUnary(exp expressions.Unary) (interface{}, error) {
 		return -num, nil
 	}
 
-	return nil, errors.New("TODO")
+	return nil, newRuntimeError(exp.Operator.Span(), "TODO")
 }
 
-func (i *interpreter) isTruthy(val interface{}) bool {
+func isTruthy(val interface{}) bool {
 	if val == nil {
 		return false
 	}
@@ -260,7 +435,7 @@ func (i *interpreter) isTruthy(val interface{}) bool {
 	return true
 }
 
-func castToFloats(a, b interface{}) (float64, float64, error) {
+func castToFloats(operator tokens.Token, a, b interface{}) (float64, float64, error) {
 
 	aFloat, aok := a.(float64)
 	bFloat, bok := b.(float64)
@@ -269,7 +444,7 @@ func castToFloats(a, b interface{}) (float64, float64, error) {
 		return aFloat, bFloat, nil
 	}
 
-	return 0, 0, errors.New("not a number")
+	return 0, 0, newRuntimeError(operator.Span(), "Operands must be numbers.")
 }
 
 func (i *interpreter) VisitBinary(exp expressions.Binary) (interface{}, error) {
@@ -284,25 +459,25 @@ func (i *interpreter) VisitBinary(exp expressions.Binary) (interface{}, error) {
 
 	switch exp.Operator.TokenType {
 	case tokens.MINUS:
-		left, right, err := castToFloats(left, right)
+		left, right, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return left - right, nil
 	case tokens.SLASH:
-		left, right, err := castToFloats(left, right)
+		left, right, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return left / right, nil
 	case tokens.STAR:
-		left, right, err := castToFloats(left, right)
+		left, right, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return left * right, nil
 	case tokens.PLUS:
-		numLeft, numRight, err := castToFloats(left, right)
+		numLeft, numRight, err := castToFloats(exp.Operator, left, right)
 		if err == nil {
 			return numLeft + numRight, nil
 		}
@@ -314,28 +489,28 @@ func (i *interpreter) VisitBinary(exp expressions.Binary) (interface{}, error) {
 			return strLeft + strRight, nil
 		}
 		// TODO: maybe define the types in msg?
-		return nil, errors.New("operands must be two numbers or two strings")
+		return nil, newRuntimeError(exp.Operator.Span(), "Operands must be two numbers or two strings.")
 
 	case tokens.GREATER:
-		numLeft, numRight, err := castToFloats(left, right)
+		numLeft, numRight, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return numLeft > numRight, nil
 	case tokens.GREATER_EQUAL:
-		numLeft, numRight, err := castToFloats(left, right)
+		numLeft, numRight, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return numLeft >= numRight, nil
 	case tokens.LESS:
-		numLeft, numRight, err := castToFloats(left, right)
+		numLeft, numRight, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
 		return numLeft < numRight, nil
 	case tokens.LESS_EQUAL:
-		numLeft, numRight, err := castToFloats(left, right)
+		numLeft, numRight, err := castToFloats(exp.Operator, left, right)
 		if err != nil {
 			return nil, err
 		}
@@ -345,7 +520,7 @@ func (i *interpreter) VisitBinary(exp expressions.Binary) (interface{}, error) {
 	case tokens.EQUAL_EQUAL:
 		return isEqual(left, right), nil
 	}
-	return nil, errors.New("TODO")
+	return nil, newRuntimeError(exp.Operator.Span(), "TODO")
 }
 
 func (i *interpreter) VisitCall(expr expressions.Call) (interface{}, error) {
@@ -365,16 +540,73 @@ func (i *interpreter) VisitCall(expr expressions.Call) (interface{}, error) {
 
 	function, ok := callee.(LoxCallable)
 	if !ok {
-		return nil, errors.New("Can only call functions and classes.")
+		return nil, newRuntimeError(expr.Span(), "Can only call functions and classes.")
 	}
 
 	arity := function.Arity()
 	got := len(arguments)
-	if got != arity {
-		return nil, fmt.Errorf("Expected %d arguments but got %d", arity, got)
+	if arity != Variadic && got != arity {
+		return nil, newRuntimeError(expr.Span(), "Expected %d arguments but got %d.", arity, got)
+	}
+
+	if err := i.limits.enter(len(i.callStack) + 1); err != nil {
+		return nil, stackOverflow(expr.Span(), i.trace())
+	}
+
+	i.callStack = append(i.callStack, StackFrame{Function: callableName(function), CallSite: expr.Span()})
+	if i.tracer != nil {
+		i.tracer.emit(PhaseInterpret, "call", expr.Span(), map[string]interface{}{
+			"function": callableName(function),
+			"depth":    len(i.callStack),
+		})
+	}
+	value, err := function.Call(i, arguments)
+	if err != nil {
+		err = i.withTrace(err, expr)
 	}
+	i.callStack = i.callStack[:len(i.callStack)-1]
 
-	return function.Call(i, arguments)
+	return value, err
+}
+
+// withTrace attaches the current call stack to an error on its way out of the call that raised it.
+// Errors from native functions carry no position, so they are placed at the call site.
+func (i *interpreter) withTrace(err error, call expressions.Call) error {
+	if stopsProgram(err) {
+		return err
+	}
+
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		runtimeErr = newRuntimeError(call.Span(), "%s", err.Error())
+	}
+
+	// the innermost call sees the error first and holds the deepest stack
+	if runtimeErr.Trace == nil {
+		runtimeErr.Trace = i.trace()
+	}
+	return runtimeErr
+}
+
+// trace lists the active calls, innermost first.
+func (i *interpreter) trace() []StackFrame {
+	trace := make([]StackFrame, len(i.callStack))
+	for n, frame := range i.callStack {
+		trace[len(i.callStack)-1-n] = frame
+	}
+	return trace
+}
+
+func callableName(function LoxCallable) string {
+	switch f := function.(type) {
+	case *LoxFunction:
+		return f.Declaration.Name.Lexeme
+	case *LoxClass:
+		return f.Name
+	case *NativeFunction:
+		return f.Name
+	}
+	return function.String()
 }
 
 func isEqual(a, b interface{}) bool {
@@ -386,3 +618,142 @@ func isEqual(a, b interface{}) bool {
 	}
 	return a == b
 }
+
+func (i *interpreter) VisitGet(expr expressions.Get) (interface{}, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if e, ok := object.(*LoxError); ok {
+		value, err := e.get(expr.Name.Lexeme)
+		if err != nil {
+			return nil, newRuntimeError(expr.Name.Span(), "%s", err.Error())
+		}
+		return value, nil
+	}
+	if m, ok := object.(*LoxModule); ok {
+		value, err := m.get(expr.Name.Lexeme)
+		if err != nil {
+			return nil, newRuntimeError(expr.Name.Span(), "%s", err.Error())
+		}
+		return value, nil
+	}
+
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		return nil, newRuntimeError(expr.Name.Span(), "Only instances have properties.")
+	}
+	return instance.get(expr.Name)
+}
+
+func (i *interpreter) VisitSet(expr expressions.Set) (interface{}, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		return nil, newRuntimeError(expr.Name.Span(), "Only instances have fields.")
+	}
+
+	value, err := i.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	instance.set(expr.Name, value)
+	return value, nil
+}
+
+func (i *interpreter) VisitThis(expr expressions.This) (interface{}, error) {
+	return i.lookUpVariable(expr.Keyword, expr.Binding)
+}
+
+func (i *interpreter) VisitSuper(expr expressions.Super) (interface{}, error) {
+	local := expr.Binding
+	if !local.Resolved {
+		// the resolver rejects 'super' anywhere it can't bind it, so this only guards against a bug there
+		return nil, newRuntimeError(expr.Keyword.Span(), "Can't use 'super' in a class with no superclass.")
+	}
+	superclass := i.environment.getAt(local.Depth, local.Slot).(*LoxClass)
+
+	// "this" is always bound one environment inside the one holding "super".
+	object := i.environment.getAt(local.Depth-1, 0).(*LoxInstance)
+
+	method, ok := superclass.findMethod(expr.Method.Lexeme)
+	if !ok {
+		return nil, newRuntimeError(expr.Method.Span(), "Undefined property '%s'.", expr.Method.Lexeme)
+	}
+	return method.bind(object), nil
+}
+
+func (i *interpreter) VisitList(expr expressions.List) (interface{}, error) {
+	elements := make([]interface{}, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		value, err := i.evaluate(element)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+	}
+	return NewLoxList(elements), nil
+}
+
+func (i *interpreter) VisitIndex(expr expressions.Index) (interface{}, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := getIndex(object, index)
+	if err != nil {
+		return nil, newRuntimeError(expr.Span(), "%s", err.Error())
+	}
+	return value, nil
+}
+
+func (i *interpreter) VisitSetIndex(expr expressions.SetIndex) (interface{}, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setIndex(object, index, value)
+	if err != nil {
+		return nil, newRuntimeError(expr.Span(), "%s", err.Error())
+	}
+	return value, nil
+}
+
+func (i *interpreter) VisitMap(expr expressions.Map) (interface{}, error) {
+	m := NewLoxMap()
+	for n := range expr.Keys {
+		key, err := i.evaluate(expr.Keys[n])
+		if err != nil {
+			return nil, err
+		}
+		value, err := i.evaluate(expr.Values[n])
+		if err != nil {
+			return nil, err
+		}
+
+		err = m.set(key, value)
+		if err != nil {
+			return nil, newRuntimeError(expr.Keys[n].Span(), "%s", err.Error())
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,150 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// FileSystem is how scripts, and the modules they import, reach files.
+// Embedders can restrict or virtualize file access by providing their own.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	AppendFile(name string, data []byte) error
+	Exists(name string) bool
+}
+
+// OSFileSystem is the FileSystem of the host operating system, used by default.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0644)
+}
+
+func (OSFileSystem) AppendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (OSFileSystem) Exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func ioNatives(in *Interpreter) []nativeDef {
+	return []nativeDef{
+		{"readFile", 1, in.readFile},
+		{"readLines", 1, in.readLines},
+		{"writeFile", 2, in.writeFile},
+		{"appendFile", 2, in.appendFile},
+		{"fileExists", 1, in.fileExists},
+		{"readLine", 0, in.readLine},
+	}
+}
+
+// fileError describes a failed file operation without repeating Go's "open path:" prefix.
+func fileError(action string, path string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	return fmt.Errorf("Can't %s file '%s': %s.", action, path, err)
+}
+
+func (in *Interpreter) readFile(args []Value) (Value, error) {
+	path, err := argString("readFile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := in.fs.ReadFile(path)
+	if err != nil {
+		return nil, fileError("read", path, err)
+	}
+	return string(data), nil
+}
+
+// readLines returns a list of the file's lines without their line endings.
+func (in *Interpreter) readLines(args []Value) (Value, error) {
+	path, err := argString("readLines", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := in.fs.ReadFile(path)
+	if err != nil {
+		return nil, fileError("read", path, err)
+	}
+
+	lines := []Value{}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return NewLoxList(lines), nil
+}
+
+func (in *Interpreter) writeFile(args []Value) (Value, error) {
+	path, err := argString("writeFile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	text, err := argString("writeFile", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.fs.WriteFile(path, []byte(text)); err != nil {
+		return nil, fileError("write", path, err)
+	}
+	return nil, nil
+}
+
+func (in *Interpreter) appendFile(args []Value) (Value, error) {
+	path, err := argString("appendFile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	text, err := argString("appendFile", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.fs.AppendFile(path, []byte(text)); err != nil {
+		return nil, fileError("append to", path, err)
+	}
+	return nil, nil
+}
+
+func (in *Interpreter) fileExists(args []Value) (Value, error) {
+	path, err := argString("fileExists", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return in.fs.Exists(path), nil
+}
+
+// readLine returns the next line of standard input without its line ending, or nil at the end of input.
+func (in *Interpreter) readLine(args []Value) (Value, error) {
+	line, err := in.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return nil, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Can't read from standard input: %s.", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
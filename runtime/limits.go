@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+var (
+	// ErrStepLimit aborts a program that runs more steps than WithMaxSteps allows.
+	ErrStepLimit = errors.New("step limit exceeded")
+	// ErrStackOverflow is wrapped by the runtime error raised when a program nests
+	// more calls than WithMaxCallDepth allows. Scripts can catch it.
+	ErrStackOverflow = errors.New("stack overflow")
+)
+
+// AbortError stops a program that hit an execution limit or whose context is done.
+// Unlike a RuntimeError it can't be caught by the script.
+// Err is ErrStepLimit or the context's error, so use errors.Is to tell them apart.
+type AbortError struct {
+	Span tokens.Span
+	Err  error
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("Execution aborted: %s.", e.Err)
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+// WithMaxSteps aborts programs after the number of steps: statements on the
+// tree-walker, instructions on the virtual machine. Zero means no limit.
+func WithMaxSteps(steps int) Option {
+	return func(in *Interpreter) {
+		in.limits.maxSteps = steps
+	}
+}
+
+// DefaultMaxCallDepth is the call depth allowed unless WithMaxCallDepth says otherwise.
+const DefaultMaxCallDepth = 4096
+
+// WithMaxCallDepth sets how deeply calls may nest before a "Stack overflow."
+// runtime error is raised. Zero or less means DefaultMaxCallDepth.
+func WithMaxCallDepth(depth int) Option {
+	return func(in *Interpreter) {
+		in.limits.maxDepth = depth
+	}
+}
+
+// doneInterval is how many steps pass between checks of the context,
+// which are too slow to make on every step.
+const doneInterval = 1024
+
+// limits is shared by both backends and counts the steps of a single run.
+type limits struct {
+	ctx       context.Context
+	done      <-chan struct{} // nil when the context can't be canceled
+	steps     int
+	nextCheck int // step at which the limits are checked next
+	maxSteps  int
+	maxDepth  int
+}
+
+func (l *limits) start(ctx context.Context) {
+	l.ctx = ctx
+	l.done = ctx.Done()
+	l.steps = 0
+	l.schedule()
+}
+
+// step counts one step, returning the reason to abort if there is one.
+// It is small enough to be inlined into the backends' loops.
+func (l *limits) step() error {
+	l.steps++
+	if l.steps < l.nextCheck {
+		return nil
+	}
+	return l.check()
+}
+
+func (l *limits) check() error {
+	if l.maxSteps > 0 && l.steps > l.maxSteps {
+		return ErrStepLimit
+	}
+	if l.done != nil {
+		select {
+		case <-l.done:
+			return l.ctx.Err()
+		default:
+		}
+	}
+	l.schedule()
+	return nil
+}
+
+func (l *limits) schedule() {
+	l.nextCheck = math.MaxInt
+	if l.done != nil {
+		l.nextCheck = l.steps + doneInterval
+	}
+	if l.maxSteps > 0 && l.maxSteps+1 < l.nextCheck {
+		l.nextCheck = l.maxSteps + 1
+	}
+}
+
+// enter checks a call at the given depth is allowed.
+func (l *limits) enter(depth int) error {
+	if depth > l.maxDepth {
+		return ErrStackOverflow
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// LoxList is the value of a list literal. Lists are shared by reference.
+type LoxList struct {
+	Elements []Value
+}
+
+func NewLoxList(elements []Value) *LoxList {
+	return &LoxList{Elements: elements}
+}
+
+func (l *LoxList) String() string {
+	parts := make([]string, len(l.Elements))
+	for i, e := range l.Elements {
+		parts[i] = stringifyElement(e)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// stringifyElement quotes strings so they stand out inside collections.
+func stringifyElement(v Value) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return stringify(v)
+}
+
+// toIndex checks the value is an integer in [0, length].
+func toIndex(v Value, length int) (int, error) {
+	num, ok := v.(float64)
+	if !ok || num != math.Trunc(num) {
+		return 0, fmt.Errorf("List index must be an integer but got %s.", stringifyElement(v))
+	}
+	if num < 0 || num > float64(length) {
+		return 0, fmt.Errorf("Index %s out of bounds for list of length %d.", stringify(num), length)
+	}
+	return int(num), nil
+}
+
+// elementIndex checks the value indexes an existing element.
+func (l *LoxList) elementIndex(v Value) (int, error) {
+	i, err := toIndex(v, len(l.Elements))
+	if err != nil {
+		return 0, err
+	}
+	if i == len(l.Elements) {
+		return 0, fmt.Errorf("Index %d out of bounds for list of length %d.", i, len(l.Elements))
+	}
+	return i, nil
+}
+
+func (l *LoxList) get(index Value) (Value, error) {
+	i, err := l.elementIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	return l.Elements[i], nil
+}
+
+func (l *LoxList) set(index Value, value Value) error {
+	i, err := l.elementIndex(index)
+	if err != nil {
+		return err
+	}
+	l.Elements[i] = value
+	return nil
+}
+
+// getIndex implements 'object[index]' for every indexable type.
+func getIndex(object Value, index Value) (Value, error) {
+	switch o := object.(type) {
+	case *LoxList:
+		return o.get(index)
+	case *LoxMap:
+		return o.get(index)
+	}
+	return nil, fmt.Errorf("Can't index a %s.", typeName(object))
+}
+
+// setIndex implements 'object[index] = value' for every indexable type.
+func setIndex(object Value, index Value, value Value) error {
+	switch o := object.(type) {
+	case *LoxList:
+		return o.set(index, value)
+	case *LoxMap:
+		return o.set(index, value)
+	}
+	return fmt.Errorf("Can't assign to an index of a %s.", typeName(object))
+}
+
+var listNatives = []nativeDef{
+	{"len", 1, lenNative},
+	{"push", 2, listPush},
+	{"pop", 1, listPop},
+	{"insert", 3, listInsert},
+	{"slice", 3, listSlice},
+}
+
+// listPush appends the value to the list.
+func listPush(args []Value) (Value, error) {
+	list, err := argList("push", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	list.Elements = append(list.Elements, args[1])
+	return nil, nil
+}
+
+// listPop removes and returns the last element.
+func listPop(args []Value) (Value, error) {
+	list, err := argList("pop", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Elements) == 0 {
+		return nil, errors.New("Can't pop from an empty list.")
+	}
+
+	last := list.Elements[len(list.Elements)-1]
+	list.Elements = list.Elements[:len(list.Elements)-1]
+	return last, nil
+}
+
+// listInsert inserts the value before the index; an index equal to the length appends.
+func listInsert(args []Value) (Value, error) {
+	list, err := argList("insert", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := toIndex(args[1], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+
+	list.Elements = append(list.Elements, nil)
+	copy(list.Elements[i+1:], list.Elements[i:])
+	list.Elements[i] = args[2]
+	return nil, nil
+}
+
+// listSlice returns a new list of the elements from start up to, but not including, end.
+func listSlice(args []Value) (Value, error) {
+	list, err := argList("slice", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, err := toIndex(args[1], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+	end, err := toIndex(args[2], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("Slice start %d is after its end %d.", start, end)
+	}
+
+	elements := make([]Value, end-start)
+	copy(elements, list.Elements[start:end])
+	return NewLoxList(elements), nil
+}
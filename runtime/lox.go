@@ -0,0 +1,284 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/awgraves/go-lox/expressions"
+	"github.com/awgraves/go-lox/statements"
+)
+
+// Value is any value a Lox program can produce:
+// nil, bool, float64, string or one of the runtime's callable / object types.
+type Value = interface{}
+
+var (
+	// ErrSyntax is returned when the source could not be scanned or parsed.
+	ErrSyntax = errors.New("syntax error")
+	// ErrResolve is returned when the parsed program fails static resolution.
+	ErrResolve = errors.New("resolution error")
+	// ErrCompile is returned when the program can't be compiled to bytecode.
+	ErrCompile = errors.New("compile error")
+)
+
+// Backend selects how an Interpreter executes programs.
+type Backend int
+
+const (
+	// TreeWalker evaluates the syntax tree directly.
+	TreeWalker Backend = iota
+	// BytecodeVM compiles programs to bytecode run by a stack based virtual machine.
+	BytecodeVM
+)
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithErrorReporter replaces the default error reporter.
+func WithErrorReporter(r ErrorReporter) Option {
+	return func(in *Interpreter) {
+		in.errReporter = r
+	}
+}
+
+// WithBackend selects the execution backend. The tree-walker is the default.
+func WithBackend(backend Backend) Option {
+	return func(in *Interpreter) {
+		in.backend = backend
+	}
+}
+
+// WithColor turns ANSI colors on or off in the default reporter's diagnostics.
+// Colors are off by default.
+func WithColor(enabled bool) Option {
+	return func(in *Interpreter) {
+		in.color = enabled
+	}
+}
+
+// WithSearchPath adds directories searched, in order, for imported modules
+// not found relative to the importing file.
+func WithSearchPath(dirs ...string) Option {
+	return func(in *Interpreter) {
+		in.searchPath = append(in.searchPath, dirs...)
+	}
+}
+
+// WithFileSystem replaces the host file system used by the file natives and imports.
+func WithFileSystem(fs FileSystem) Option {
+	return func(in *Interpreter) {
+		in.fs = fs
+	}
+}
+
+// WithStdin sets where readLine and the shell read from. It is os.Stdin by default.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) {
+		in.stdin = bufio.NewReader(r)
+	}
+}
+
+// WithStdout sets where print writes to. It is os.Stdout by default.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stdout = w
+	}
+}
+
+// WithStderr sets where the default reporter and the shell write diagnostics to.
+// It is os.Stderr by default.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) {
+		in.stderr = w
+	}
+}
+
+// Interpreter is the embeddable entry point to the Lox runtime.
+// Every error found while evaluating is also added to its ErrorReporter.
+type Interpreter struct {
+	errReporter  ErrorReporter
+	color        bool
+	backend      Backend
+	interpreter  *interpreter
+	resolver     *resolver
+	vm           *vm // only set for the BytecodeVM backend
+	searchPath   []string
+	modules      *moduleLoader
+	fs           FileSystem
+	stdin        *bufio.Reader
+	stdout       io.Writer           // program output
+	stderr       io.Writer           // diagnostics
+	capabilities map[Capability]bool // nil grants every capability
+	limits       *limits
+	lastID       expressions.ID // of the last expression parsed
+	tracer       *tracer        // nil unless tracing
+}
+
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{limits: &limits{}}
+	for _, opt := range opts {
+		opt(in)
+	}
+	if in.limits.maxDepth <= 0 {
+		in.limits.maxDepth = DefaultMaxCallDepth
+	}
+	if in.stdout == nil {
+		in.stdout = os.Stdout
+	}
+	if in.stderr == nil {
+		in.stderr = os.Stderr
+	}
+	if in.errReporter == nil {
+		in.errReporter = newBasicErrorReporter(in.stderr, in.color)
+	}
+	if in.fs == nil {
+		in.fs = OSFileSystem{}
+	}
+	if in.stdin == nil {
+		in.stdin = bufio.NewReader(os.Stdin)
+	}
+
+	in.modules = newModuleLoader(in, in.searchPath)
+	in.interpreter = newIntepreter(in.errReporter, in.modules, in.limits, in.tracer, in.stdout)
+	in.resolver = newResolver(in.interpreter)
+	if in.backend == BytecodeVM {
+		in.vm = newVM(in.modules, in.limits, in.tracer, in.stdout)
+	}
+
+	in.defineNatives(listNatives)
+	in.defineNatives(mapNatives)
+	in.defineNatives(stringNatives)
+	in.modules.native["math"] = mathModule()
+
+	if in.granted(CapabilityTime) {
+		in.DefineNative("clock", 0, clock)
+	}
+	if in.granted(CapabilityIO) {
+		in.defineNatives(ioNatives(in))
+	}
+	if in.granted(CapabilityOS) {
+		in.defineNatives(osNatives)
+	}
+	if in.granted(CapabilityRandom) {
+		in.defineNatives(randomNatives)
+	}
+	return in
+}
+
+// ErrorReporter returns the reporter errors are collected in.
+func (in *Interpreter) ErrorReporter() ErrorReporter {
+	return in.errReporter
+}
+
+// Define binds a value to a global name visible to every script and module run afterwards.
+func (in *Interpreter) Define(name string, value Value) {
+	if in.vm != nil {
+		in.vm.define(name, value)
+		return
+	}
+	in.interpreter.builtins.define(name, value)
+}
+
+// DefineNative registers a Go function as a global Lox function.
+// Pass Variadic as the arity to accept any number of arguments.
+func (in *Interpreter) DefineNative(name string, arity int, fn NativeFn) {
+	in.Define(name, NewNativeFunction(name, arity, fn))
+}
+
+// Parse scans and parses the source into statements without executing them.
+func (in *Interpreter) Parse(src string) ([]statements.Stmt, error) {
+	return in.parse(src, "")
+}
+
+// parse is Parse for source read from the named file.
+func (in *Interpreter) parse(src string, file string) ([]statements.Stmt, error) {
+	in.errReporter.Reset()
+	if recorder, ok := in.errReporter.(sourceRecorder); ok {
+		recorder.AddSource(file, src)
+	}
+
+	scanner := newScanner(src, file, in.errReporter, in.tracer)
+	scanner.ScanTokens()
+	if in.errReporter.HasError() {
+		return nil, ErrSyntax
+	}
+
+	parser := newParser(scanner.Tokens, in.errReporter, &in.lastID, in.tracer)
+	stmts := parser.parse()
+	if in.errReporter.HasError() {
+		return nil, ErrSyntax
+	}
+
+	return stmts, nil
+}
+
+// Run resolves and executes already parsed statements.
+// If the last statement is an expression statement its value is returned.
+// Runtime failures are returned as a *RuntimeError carrying the Lox stack trace.
+func (in *Interpreter) Run(stmts []statements.Stmt) (Value, error) {
+	return in.RunContext(context.Background(), stmts)
+}
+
+// RunContext is Run that stops with an *AbortError once ctx is done.
+func (in *Interpreter) RunContext(ctx context.Context, stmts []statements.Stmt) (Value, error) {
+	in.errReporter.Reset()
+	in.limits.start(ctx)
+
+	in.resolver.resolveStmts(stmts)
+	if in.errReporter.HasError() {
+		return nil, ErrResolve
+	}
+
+	if in.vm == nil {
+		return in.interpreter.interpret(stmts)
+	}
+
+	function, ok := compile(stmts, in.errReporter)
+	if !ok {
+		return nil, ErrCompile
+	}
+
+	value, err := in.vm.interpret(function)
+	if err != nil {
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			in.errReporter.AddError(runtimeDiagnostic(err))
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// Eval parses and runs the source.
+func (in *Interpreter) Eval(src string) (Value, error) {
+	return in.eval(context.Background(), src, "")
+}
+
+// EvalContext is Eval that stops with an *AbortError once ctx is done.
+func (in *Interpreter) EvalContext(ctx context.Context, src string) (Value, error) {
+	return in.eval(ctx, src, "")
+}
+
+func (in *Interpreter) eval(ctx context.Context, src string, file string) (Value, error) {
+	stmts, err := in.parse(src, file)
+	if err != nil {
+		return nil, err
+	}
+
+	return in.RunContext(ctx, stmts)
+}
+
+// EvalFile reads the file at path from the interpreter's FileSystem and evaluates its contents.
+func (in *Interpreter) EvalFile(path string) (Value, error) {
+	bytes, err := in.fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file path %s: %w", path, err)
+	}
+
+	defer in.modules.enter(path)()
+	return in.eval(context.Background(), string(bytes), path)
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoxMap is the value of a map literal. Maps are shared by reference
+// and iterate in insertion order.
+type LoxMap struct {
+	positions map[Value]int // index of each key in keys and values
+	keys      []Value
+	values    []Value
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{positions: make(map[Value]int)}
+}
+
+// checkKey restricts keys to the types isEqual compares by value.
+func checkKey(key Value) error {
+	switch key.(type) {
+	case nil, bool, float64, string:
+		return nil
+	}
+	return fmt.Errorf("Map keys must be strings, numbers, booleans or nil but got %s.", typeName(key))
+}
+
+func (m *LoxMap) get(key Value) (Value, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	n, ok := m.positions[key]
+	if !ok {
+		return nil, fmt.Errorf("Key %s not found in map.", stringifyElement(key))
+	}
+	return m.values[n], nil
+}
+
+func (m *LoxMap) set(key Value, value Value) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if n, ok := m.positions[key]; ok {
+		m.values[n] = value
+		return nil
+	}
+
+	m.positions[key] = len(m.keys)
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, value)
+	return nil
+}
+
+func (m *LoxMap) has(key Value) bool {
+	_, ok := m.positions[key]
+	return ok
+}
+
+// delete removes the key, reporting whether it was present.
+func (m *LoxMap) delete(key Value) bool {
+	n, ok := m.positions[key]
+	if !ok {
+		return false
+	}
+
+	delete(m.positions, key)
+	m.keys = append(m.keys[:n], m.keys[n+1:]...)
+	m.values = append(m.values[:n], m.values[n+1:]...)
+	for i := n; i < len(m.keys); i++ {
+		m.positions[m.keys[i]] = i
+	}
+	return true
+}
+
+func (m *LoxMap) String() string {
+	parts := make([]string, len(m.keys))
+	for i := range m.keys {
+		parts[i] = stringifyElement(m.keys[i]) + ": " + stringifyElement(m.values[i])
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+var mapNatives = []nativeDef{
+	{"keys", 1, mapKeys},
+	{"values", 1, mapValues},
+	{"has", 2, mapHas},
+	{"delete", 2, mapDelete},
+}
+
+// mapKeys returns a new list of the map's keys in insertion order.
+func mapKeys(args []Value) (Value, error) {
+	m, err := argMap("keys", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewLoxList(append([]Value{}, m.keys...)), nil
+}
+
+// mapValues returns a new list of the map's values in insertion order.
+func mapValues(args []Value) (Value, error) {
+	m, err := argMap("values", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewLoxList(append([]Value{}, m.values...)), nil
+}
+
+func mapHas(args []Value) (Value, error) {
+	m, err := argMap("has", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKey(args[1]); err != nil {
+		return nil, err
+	}
+	return m.has(args[1]), nil
+}
+
+// mapDelete removes the key and returns whether it was present.
+func mapDelete(args []Value) (Value, error) {
+	m, err := argMap("delete", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKey(args[1]); err != nil {
+		return nil, err
+	}
+	return m.delete(args[1]), nil
+}
@@ -0,0 +1,115 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// mathModule is imported with `import "math";` or `import "math" as m;`.
+// Its functions raise an error where the result would be NaN.
+func mathModule() *LoxModule {
+	values := map[string]Value{
+		"PI": math.Pi,
+		"E":  math.E,
+	}
+	for _, def := range []nativeDef{
+		mathFunc("sqrt", math.Sqrt),
+		mathFunc("floor", math.Floor),
+		mathFunc("ceil", math.Ceil),
+		mathFunc("round", math.Round),
+		mathFunc("abs", math.Abs),
+		mathFunc("exp", math.Exp),
+		mathFunc("log", math.Log),
+		mathFunc("sin", math.Sin),
+		mathFunc("cos", math.Cos),
+		mathFunc("tan", math.Tan),
+		mathFunc("asin", math.Asin),
+		mathFunc("acos", math.Acos),
+		mathFunc("atan", math.Atan),
+		{"pow", 2, mathPow},
+		{"atan2", 2, mathAtan2},
+		{"min", Variadic, mathMin},
+		{"max", Variadic, mathMax},
+	} {
+		values[def.name] = NewNativeFunction(def.name, def.arity, def.fn)
+	}
+	return &LoxModule{Name: "math", values: values}
+}
+
+// mathFunc wraps a function of one number.
+func mathFunc(name string, f func(float64) float64) nativeDef {
+	return nativeDef{name, 1, func(args []Value) (Value, error) {
+		x, err := argNumber(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		result := f(x)
+		if math.IsNaN(result) {
+			return nil, fmt.Errorf("%s is undefined for %s.", name, stringify(x))
+		}
+		return result, nil
+	}}
+}
+
+func mathPow(args []Value) (Value, error) {
+	base, err := argNumber("pow", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	exponent, err := argNumber("pow", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	result := math.Pow(base, exponent)
+	if math.IsNaN(result) {
+		return nil, fmt.Errorf("pow is undefined for %s raised to %s.", stringify(base), stringify(exponent))
+	}
+	return result, nil
+}
+
+func mathAtan2(args []Value) (Value, error) {
+	y, err := argNumber("atan2", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	x, err := argNumber("atan2", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	result := math.Atan2(y, x)
+	if math.IsNaN(result) {
+		return nil, errors.New("atan2 is undefined for NaN.")
+	}
+	return result, nil
+}
+
+func mathMin(args []Value) (Value, error) {
+	return extremum("min", args, math.Min)
+}
+
+func mathMax(args []Value) (Value, error) {
+	return extremum("max", args, math.Max)
+}
+
+// extremum folds one or more numbers with pick.
+func extremum(name string, args []Value, pick func(a, b float64) float64) (Value, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s expects at least 1 argument.", name)
+	}
+	result, err := argNumber(name, args, 0)
+	if err != nil {
+		return nil, err
+	}
+	for n := 1; n < len(args); n++ {
+		x, err := argNumber(name, args, n)
+		if err != nil {
+			return nil, err
+		}
+		result = pick(result, x)
+	}
+	if math.IsNaN(result) {
+		return nil, fmt.Errorf("%s is undefined for NaN.", name)
+	}
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package runtime
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+// LoxModule is the namespace bound by `import "path" as name;`.
+// Its properties are the module's top-level variables.
+type LoxModule struct {
+	Name   string
+	values map[string]Value
+}
+
+func (m *LoxModule) String() string {
+	return fmt.Sprintf("<module %s>", m.Name)
+}
+
+func (m *LoxModule) get(name string) (Value, error) {
+	value, ok := m.values[name]
+	if !ok {
+		return nil, fmt.Errorf("Undefined name '%s' in module %s.", name, m.Name)
+	}
+	return value, nil
+}
+
+// moduleLoader finds, runs and caches the modules imported by scripts.
+// Each module runs once, in its own globals, the first time it is imported.
+type moduleLoader struct {
+	in         *Interpreter
+	searchPath []string
+	native     map[string]*LoxModule
+	loaded     map[string]*LoxModule // keyed by absolute path
+	loading    []string              // absolute paths of the scripts being run, outermost first
+}
+
+func newModuleLoader(in *Interpreter, searchPath []string) *moduleLoader {
+	return &moduleLoader{
+		in:         in,
+		searchPath: searchPath,
+		native:     make(map[string]*LoxModule),
+		loaded:     make(map[string]*LoxModule),
+	}
+}
+
+// enter marks the script in file as running until the returned func is called,
+// so that a module importing it again is reported as a cycle.
+func (l *moduleLoader) enter(file string) func() {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return func() {}
+	}
+	l.loading = append(l.loading, abs)
+	return func() { l.loading = l.loading[:len(l.loading)-1] }
+}
+
+// load returns the module for an import of path by the statement at site.
+func (l *moduleLoader) load(path string, site tokens.Span) (*LoxModule, error) {
+	if module, ok := l.native[path]; ok {
+		return module, nil
+	}
+	// modules other than the built-in ones are files, so they need the same capability as the file natives
+	if !l.in.granted(CapabilityIO) {
+		return nil, fmt.Errorf("Can't import module '%s' without the io capability.", path)
+	}
+
+	file, err := l.find(path, site.Start.File)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("Can't find module '%s'.", path)
+	}
+	if module, ok := l.loaded[abs]; ok {
+		return module, nil
+	}
+
+	for n, loading := range l.loading {
+		if loading == abs {
+			cycle := []string{}
+			for _, f := range append(l.loading[n:], file) {
+				cycle = append(cycle, filepath.Base(f))
+			}
+			return nil, fmt.Errorf("Import cycle: %s.", strings.Join(cycle, " -> "))
+		}
+	}
+
+	bytes, err := l.in.fs.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read module '%s'.", path)
+	}
+
+	l.loading = append(l.loading, abs)
+	values, err := l.in.runModule(string(bytes), file, site)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	module := &LoxModule{Name: path, values: values}
+	l.loaded[abs] = module
+	return module, nil
+}
+
+// find resolves a relative path against the importing file's directory,
+// then each directory of the search path in order.
+func (l *moduleLoader) find(path string, importer string) (string, error) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(filepath.Dir(importer), path)}
+		for _, dir := range l.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if l.in.fs.Exists(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("Can't find module '%s'.", path)
+}
+
+// countingReporter forwards diagnostics, counting them, so a module's errors
+// are told apart from those the reporter already held.
+type countingReporter struct {
+	ErrorReporter
+	errors int
+}
+
+func (r *countingReporter) AddError(d Diagnostic) {
+	r.errors++
+	r.ErrorReporter.AddError(d)
+}
+
+// runModule parses, resolves and runs the source of a module in fresh globals,
+// returning its top-level variables. While it runs, the module is a frame
+// of the stack trace, called at the import statement at site.
+func (in *Interpreter) runModule(src string, file string, site tokens.Span) (map[string]Value, error) {
+	if recorder, ok := in.errReporter.(sourceRecorder); ok {
+		recorder.AddSource(file, src)
+	}
+	reporter := &countingReporter{ErrorReporter: in.errReporter}
+	moduleErr := fmt.Errorf("Module '%s' has errors.", filepath.Base(file))
+
+	scanner := newScanner(src, file, reporter, in.tracer)
+	scanner.ScanTokens()
+	if reporter.errors > 0 {
+		return nil, moduleErr
+	}
+
+	parser := newParser(scanner.Tokens, reporter, &in.lastID, in.tracer)
+	stmts := parser.parse()
+	if reporter.errors > 0 {
+		return nil, moduleErr
+	}
+
+	in.resolver.errReporter = reporter
+	in.resolver.resolveStmts(stmts)
+	in.resolver.errReporter = in.errReporter
+	if reporter.errors > 0 {
+		return nil, moduleErr
+	}
+
+	if in.vm == nil {
+		return in.interpreter.runModule(stmts, StackFrame{Function: filepath.Base(file), CallSite: site})
+	}
+
+	function, ok := compile(stmts, reporter)
+	if !ok {
+		return nil, moduleErr
+	}
+	return in.vm.runModule(function, file)
+}
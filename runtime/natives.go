@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// nativeDef describes a native function defined in the globals of every interpreter.
+type nativeDef struct {
+	name  string
+	arity int
+	fn    NativeFn
+}
+
+func (in *Interpreter) defineNatives(defs []nativeDef) {
+	for _, def := range defs {
+		in.DefineNative(def.name, def.arity, def.fn)
+	}
+}
+
+// typeName describes a value's type in error messages.
+func typeName(v Value) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *LoxList:
+		return "list"
+	case *LoxMap:
+		return "map"
+	case *LoxError:
+		return "error"
+	case *LoxModule:
+		return "module"
+	case LoxCallable, *vmClosure, *vmBoundMethod, *vmClass:
+		return "function"
+	}
+	return "object"
+}
+
+func argNumber(fn string, args []Value, n int) (float64, error) {
+	num, ok := args[n].(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s expects a number as argument %d but got %s.", fn, n+1, typeName(args[n]))
+	}
+	return num, nil
+}
+
+func argList(fn string, args []Value, n int) (*LoxList, error) {
+	list, ok := args[n].(*LoxList)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a list as argument %d but got %s.", fn, n+1, typeName(args[n]))
+	}
+	return list, nil
+}
+
+// lenNative returns the length of a list, the number of entries in a map
+// or the number of code points in a string.
+func lenNative(args []Value) (Value, error) {
+	switch v := args[0].(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case *LoxList:
+		return float64(len(v.Elements)), nil
+	case *LoxMap:
+		return float64(len(v.keys)), nil
+	}
+	return nil, fmt.Errorf("Can't take the length of a %s.", typeName(args[0]))
+}
+
+func argMap(fn string, args []Value, n int) (*LoxMap, error) {
+	m, ok := args[n].(*LoxMap)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a map as argument %d but got %s.", fn, n+1, typeName(args[n]))
+	}
+	return m, nil
+}
@@ -13,15 +13,25 @@ type parser struct {
 	source      []*tokens.Token
 	current     int
 	errReporter ErrorReporter
+	lastID      *expressions.ID // shared by every parser of an Interpreter, so IDs stay unique across scripts
+	panicMode   bool            // set by a syntax error until the parser reaches the next statement
+	tracer      *tracer
 }
 
-func newParser(source []*tokens.Token, errReporter ErrorReporter) *parser {
+func newParser(source []*tokens.Token, errReporter ErrorReporter, lastID *expressions.ID, tracer *tracer) *parser {
 	return &parser{
 		source:      source,
 		errReporter: errReporter,
+		lastID:      lastID,
+		tracer:      tracer,
 	}
 }
 
+func (p *parser) nextID() expressions.ID {
+	*p.lastID++
+	return *p.lastID
+}
+
 // parse will attempt to parse the tokens into statements.
 // it is the caller's responsibility to check the err reporter as to whether this list of statements is usable.
 func (p *parser) parse() []statements.Stmt {
@@ -33,25 +43,85 @@ func (p *parser) parse() []statements.Stmt {
 	return statements
 }
 
+// declaration parses a declaration or statement. After a syntax error the rest of it is
+// skipped, so parsing resumes at the next statement without a cascade of follow-on errors.
+// The returned statement is then incomplete, but the error keeps it from being run.
 func (p *parser) declaration() statements.Stmt {
+	start := p.current
+	stmt := p.declarationOrStatement()
+	if p.panicMode {
+		// always move past at least one token so a stray token can't stop the parser
+		if p.current == start {
+			p.advance()
+		}
+		p.synchronize()
+		if p.tracer != nil {
+			p.tracer.emit(PhaseParse, "synchronize", p.peek().Span(), map[string]interface{}{"tokens": p.current - start})
+		}
+		return stmt
+	}
+	if p.tracer != nil {
+		p.tracer.emit(PhaseParse, "statement", stmt.Span(), map[string]interface{}{"kind": statementKind(stmt)})
+	}
+	return stmt
+}
+
+func (p *parser) declarationOrStatement() statements.Stmt {
+	if p.match(tokens.CLASS) {
+		return p.classDeclaration()
+	}
 	if p.match(tokens.FUN) {
 		return p.function("function")
 	}
 	if p.match(tokens.VAR) {
 		return p.varDeclaration()
 	}
+	if p.match(tokens.IMPORT) {
+		return p.importDeclaration()
+	}
 
 	return p.statement()
 }
 
-func (p *parser) varDeclaration() statements.Stmt {
-	_, err := p.consume(tokens.IDENTIFIER, "Expect variable name.")
-	if err != nil {
-		// TODO: better handle
-		panic(err)
+func (p *parser) importDeclaration() statements.Stmt {
+	keyword := p.previous()
+	path, _ := p.consume(tokens.STRING, "Expect module path string after 'import'.")
+
+	// 'as' is only special here, so it remains usable as a variable name
+	var name *tokens.Token
+	if p.check(tokens.IDENTIFIER) && p.peek().Lexeme == "as" {
+		p.advance()
+		ident, _ := p.consume(tokens.IDENTIFIER, "Expect module name after 'as'.")
+		name = &ident
 	}
 
-	name := p.previous()
+	p.consume(tokens.SEMICOLON, "Expect ';' after import.")
+	return statements.ImportStmt{Keyword: keyword, Path: path, Name: name}
+}
+
+func (p *parser) classDeclaration() statements.Stmt {
+	name, _ := p.consume(tokens.IDENTIFIER, "Expect class name.")
+
+	var superclass *expressions.Variable
+	if p.match(tokens.LESS) {
+		p.consume(tokens.IDENTIFIER, "Expect superclass name.")
+		superclass = &expressions.Variable{ID: p.nextID(), Name: p.previous(), Binding: &expressions.Binding{}}
+	}
+
+	p.consume(tokens.LEFT_BRACE, "Expect '{' before class body.")
+
+	methods := []statements.FunctionStmt{}
+	for !p.check(tokens.RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+
+	p.consume(tokens.RIGHT_BRACE, "Expect '}' after class body.")
+
+	return statements.ClassStmt{Name: name, Superclass: superclass, Methods: methods}
+}
+
+func (p *parser) varDeclaration() statements.Stmt {
+	name, _ := p.consume(tokens.IDENTIFIER, "Expect variable name.")
 
 	var initializer expressions.Expression = nil
 
@@ -65,12 +135,13 @@ func (p *parser) varDeclaration() statements.Stmt {
 }
 
 func (p *parser) whileStatement() statements.Stmt {
+	keyword := p.previous()
 	p.consume(tokens.LEFT_PAREN, "Expect '(' after 'while'.")
 	condition := p.expression()
 	p.consume(tokens.RIGHT_PAREN, "Expect ')' after condition.")
 	body := p.statement()
 
-	return statements.WhileStmt{Condition: condition, Body: body}
+	return statements.WhileStmt{Keyword: keyword, Condition: condition, Body: body}
 }
 
 func (p *parser) statement() statements.Stmt {
@@ -89,14 +160,34 @@ func (p *parser) statement() statements.Stmt {
 	if p.match(tokens.WHILE) {
 		return p.whileStatement()
 	}
+	if p.match(tokens.THROW) {
+		keyword := p.previous()
+		value := p.expression()
+		p.consume(tokens.SEMICOLON, "Expect ';' after thrown value.")
+		return statements.ThrowStmt{Keyword: keyword, Value: value}
+	}
+	if p.match(tokens.TRY) {
+		return p.tryStatement()
+	}
+	if p.match(tokens.BREAK) {
+		keyword := p.previous()
+		p.consume(tokens.SEMICOLON, "Expect ';' after 'break'.")
+		return statements.BreakStmt{Keyword: keyword}
+	}
+	if p.match(tokens.CONTINUE) {
+		keyword := p.previous()
+		p.consume(tokens.SEMICOLON, "Expect ';' after 'continue'.")
+		return statements.ContinueStmt{Keyword: keyword}
+	}
 	if p.match(tokens.LEFT_BRACE) {
-		return statements.Block{Statements: p.block()}
+		return p.blockStatement(p.previous())
 	}
 
 	return p.expressionStatement()
 }
 
 func (p *parser) forStatement() statements.Stmt {
+	keyword := p.previous()
 	p.consume(tokens.LEFT_PAREN, "Expect '(' after 'for'.")
 
 	var initializer statements.Stmt
@@ -122,16 +213,11 @@ func (p *parser) forStatement() statements.Stmt {
 
 	body := p.statement()
 
-	if increment != nil {
-		body = statements.Block{
-			Statements: []statements.Stmt{body, statements.ExpStmt{Expression: increment}},
-		}
-	}
-
 	if condition == nil {
-		condition = expressions.Literal{Value: true}
+		condition = expressions.Literal{ID: p.nextID(), Value: true}
 	}
-	body = statements.WhileStmt{Condition: condition, Body: body}
+	// the increment stays out of the body so that continue still runs it
+	body = statements.WhileStmt{Keyword: keyword, Condition: condition, Body: body, Increment: increment}
 
 	if initializer != nil {
 		body = statements.Block{Statements: []statements.Stmt{initializer, body}}
@@ -140,7 +226,37 @@ func (p *parser) forStatement() statements.Stmt {
 	return body
 }
 
+func (p *parser) tryStatement() statements.Stmt {
+	keyword := p.previous()
+	leftBrace, _ := p.consume(tokens.LEFT_BRACE, "Expect '{' after 'try'.")
+	body := p.blockStatement(leftBrace)
+
+	var catch *statements.CatchClause
+	if p.match(tokens.CATCH) {
+		catchKeyword := p.previous()
+		p.consume(tokens.LEFT_PAREN, "Expect '(' after 'catch'.")
+		name, _ := p.consume(tokens.IDENTIFIER, "Expect error variable name.")
+		p.consume(tokens.RIGHT_PAREN, "Expect ')' after error variable.")
+		p.consume(tokens.LEFT_BRACE, "Expect '{' before catch body.")
+		catchBody, rightBrace := p.block()
+		catch = &statements.CatchClause{Keyword: catchKeyword, Name: name, Body: catchBody, RightBrace: rightBrace}
+	}
+
+	var finally *statements.Block
+	if p.match(tokens.FINALLY) {
+		leftBrace, _ := p.consume(tokens.LEFT_BRACE, "Expect '{' after 'finally'.")
+		block := p.blockStatement(leftBrace)
+		finally = &block
+	}
+
+	if catch == nil && finally == nil {
+		p.error(keyword, "Expect 'catch' or 'finally' after try block.")
+	}
+	return statements.TryStmt{Keyword: keyword, Body: body, Catch: catch, Finally: finally}
+}
+
 func (p *parser) ifStatement() statements.Stmt {
+	keyword := p.previous()
 	p.consume(tokens.LEFT_PAREN, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(tokens.RIGHT_PAREN, "Expect ')' after if condition.")
@@ -151,25 +267,32 @@ func (p *parser) ifStatement() statements.Stmt {
 		elseBranch = p.statement()
 	}
 
-	return statements.IfStmt{Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+	return statements.IfStmt{Keyword: keyword, Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+}
+
+// blockStatement parses the rest of a block opened by leftBrace.
+func (p *parser) blockStatement(leftBrace tokens.Token) statements.Block {
+	body, rightBrace := p.block()
+	return statements.Block{LeftBrace: leftBrace, Statements: body, RightBrace: rightBrace}
 }
 
-func (p *parser) block() []statements.Stmt {
+// block returns the statements up to the closing brace, and the brace itself.
+func (p *parser) block() ([]statements.Stmt, tokens.Token) {
 	statements := []statements.Stmt{}
 
 	for !p.check(tokens.RIGHT_BRACE) && !p.isAtEnd() {
 		statements = append(statements, p.declaration())
 	}
 
-	p.consume(tokens.RIGHT_BRACE, "Expect '}' after block.")
-	return statements
+	rightBrace, _ := p.consume(tokens.RIGHT_BRACE, "Expect '}' after block.")
+	return statements, rightBrace
 }
 
 func (p *parser) printStatement() statements.Stmt {
-
+	keyword := p.previous()
 	value := p.expression()
 	p.consume(tokens.SEMICOLON, "Expect ';' after value.")
-	return statements.PrintStmt{Expression: value}
+	return statements.PrintStmt{Keyword: keyword, Expression: value}
 }
 
 func (p *parser) returnStatement() statements.Stmt {
@@ -190,7 +313,7 @@ func (p *parser) expressionStatement() statements.Stmt {
 	return statements.ExpStmt{Expression: expr}
 }
 
-func (p *parser) function(kind string) statements.Stmt {
+func (p *parser) function(kind string) statements.FunctionStmt {
 	name, _ := p.consume(tokens.IDENTIFIER, fmt.Sprintf("Expect %s name.", kind))
 
 	p.consume(tokens.LEFT_PAREN, fmt.Sprintf("Expect '(' after %s name.", kind))
@@ -199,8 +322,7 @@ func (p *parser) function(kind string) statements.Stmt {
 	if !p.check(tokens.RIGHT_PAREN) {
 		for ok := true; ok; ok = p.match(tokens.COMMA) {
 			if len(params) >= 255 {
-				curr := p.peek()
-				p.errReporter.AddError(curr.LineNum, 0, "Can't have more than 255 parameters.")
+				p.error(p.peek(), "Can't have more than 255 parameters.")
 				break
 			}
 			ident, _ := p.consume(tokens.IDENTIFIER, "Expect parameter name.")
@@ -212,7 +334,7 @@ func (p *parser) function(kind string) statements.Stmt {
 
 	p.consume(tokens.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body.", kind))
 
-	body := p.block()
+	body, _ := p.block()
 
 	return statements.FunctionStmt{Name: name, Params: params, Body: body}
 }
@@ -226,10 +348,15 @@ func (p *parser) assignment() expressions.Expression {
 
 		if exp, ok := expr.(expressions.Variable); ok {
 			name := exp.Name
-			return expressions.Assign{Name: name, Value: value}
+			return expressions.Assign{ID: p.nextID(), Name: name, Value: value, Binding: &expressions.Binding{}}
+		}
+		if exp, ok := expr.(expressions.Get); ok {
+			return expressions.Set{ID: p.nextID(), Object: exp.Object, Name: exp.Name, Value: value}
+		}
+		if exp, ok := expr.(expressions.Index); ok {
+			return expressions.SetIndex{ID: p.nextID(), Object: exp.Object, Index: exp.Index, Bracket: exp.Bracket, Value: value}
 		}
-		// TODO: make more accurate
-		p.errReporter.AddError(0, 0, fmt.Sprintf("Invalid assignment target: %v", equals))
+		p.error(equals, "Invalid assignment target.", "only variables, fields and list or map elements can be assigned to")
 	}
 
 	return expr
@@ -241,7 +368,7 @@ func (p *parser) or() expressions.Expression {
 	for p.match(tokens.OR) {
 		operator := p.previous()
 		right := p.and()
-		expr = expressions.Logical{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Logical{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -253,7 +380,7 @@ func (p *parser) and() expressions.Expression {
 	for p.match(tokens.AND) {
 		operator := p.previous()
 		right := p.equality()
-		expr = expressions.Logical{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Logical{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -305,7 +432,7 @@ func (p *parser) equality() expressions.Expression {
 	for p.match(tokens.BANG_EQUAL, tokens.EQUAL_EQUAL) {
 		operator := p.previous()
 		right := p.comparison()
-		expr = expressions.Binary{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Binary{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -317,7 +444,7 @@ func (p *parser) comparison() expressions.Expression {
 	for p.match(tokens.GREATER, tokens.GREATER_EQUAL, tokens.LESS, tokens.LESS_EQUAL) {
 		operator := p.previous()
 		right := p.term()
-		expr = expressions.Binary{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Binary{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -329,7 +456,7 @@ func (p *parser) term() expressions.Expression {
 	for p.match(tokens.MINUS, tokens.PLUS) {
 		operator := p.previous()
 		right := p.factor()
-		expr = expressions.Binary{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Binary{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -341,7 +468,7 @@ func (p *parser) factor() expressions.Expression {
 	for p.match(tokens.SLASH, tokens.STAR) {
 		operator := p.previous()
 		right := p.unary()
-		expr = expressions.Binary{Left: expr, Operator: operator, Right: right}
+		expr = expressions.Binary{ID: p.nextID(), Left: expr, Operator: operator, Right: right}
 	}
 
 	return expr
@@ -351,7 +478,7 @@ func (p *parser) unary() expressions.Expression {
 	if p.match(tokens.BANG, tokens.MINUS) {
 		operator := p.previous()
 		right := p.unary()
-		return expressions.Unary{Operator: operator, Right: right}
+		return expressions.Unary{ID: p.nextID(), Operator: operator, Right: right}
 	}
 	return p.call()
 }
@@ -362,6 +489,13 @@ func (p *parser) call() expressions.Expression {
 	for {
 		if p.match(tokens.LEFT_PAREN) {
 			expr = p.finishCall(expr)
+		} else if p.match(tokens.DOT) {
+			name, _ := p.consume(tokens.IDENTIFIER, "Expect property name after '.'.")
+			expr = expressions.Get{ID: p.nextID(), Object: expr, Name: name}
+		} else if p.match(tokens.LEFT_BRACKET) {
+			index := p.expression()
+			bracket, _ := p.consume(tokens.RIGHT_BRACKET, "Expect ']' after index.")
+			expr = expressions.Index{ID: p.nextID(), Object: expr, Index: index, Bracket: bracket}
 		} else {
 			break
 		}
@@ -375,8 +509,7 @@ func (p *parser) finishCall(callee expressions.Expression) expressions.Expressio
 	if !p.check(tokens.RIGHT_PAREN) {
 		for ok := true; ok; ok = p.match(tokens.COMMA) {
 			if len(args) >= 255 {
-				curr := p.peek()
-				p.errReporter.AddError(curr.LineNum, 0, "Can't have more than 255 arguments.")
+				p.error(p.peek(), "Can't have more than 255 arguments.")
 				break
 			}
 			args = append(args, p.expression())
@@ -385,42 +518,90 @@ func (p *parser) finishCall(callee expressions.Expression) expressions.Expressio
 
 	paren, _ := p.consume(tokens.RIGHT_PAREN, "Expect ')' after arguments.")
 
-	return expressions.Call{Callee: callee, Paren: paren, Arguments: args}
+	return expressions.Call{ID: p.nextID(), Callee: callee, Paren: paren, Arguments: args}
+}
+
+func (p *parser) list() expressions.Expression {
+	leftBracket := p.previous()
+
+	elements := []expressions.Expression{}
+	if !p.check(tokens.RIGHT_BRACKET) {
+		for ok := true; ok; ok = p.match(tokens.COMMA) {
+			elements = append(elements, p.expression())
+		}
+	}
+
+	rightBracket, _ := p.consume(tokens.RIGHT_BRACKET, "Expect ']' after list elements.")
+	return expressions.List{ID: p.nextID(), LeftBracket: leftBracket, Elements: elements, RightBracket: rightBracket}
+}
+
+func (p *parser) mapLiteral() expressions.Expression {
+	leftBrace := p.previous()
+
+	keys := []expressions.Expression{}
+	values := []expressions.Expression{}
+	if !p.check(tokens.RIGHT_BRACE) {
+		for ok := true; ok; ok = p.match(tokens.COMMA) {
+			keys = append(keys, p.expression())
+			p.consume(tokens.COLON, "Expect ':' after map key.")
+			values = append(values, p.expression())
+		}
+	}
+
+	rightBrace, _ := p.consume(tokens.RIGHT_BRACE, "Expect '}' after map entries.")
+	return expressions.Map{ID: p.nextID(), LeftBrace: leftBrace, Keys: keys, Values: values, RightBrace: rightBrace}
 }
 
 func (p *parser) primary() expressions.Expression {
 	if p.match(tokens.FALSE) {
-		return expressions.Literal{Value: false} // TODO: better solution that interface
+		return expressions.Literal{ID: p.nextID(), Token: p.previous(), Value: false} // TODO: better solution that interface
 	}
 	if p.match(tokens.TRUE) {
-		return expressions.Literal{Value: true}
+		return expressions.Literal{ID: p.nextID(), Token: p.previous(), Value: true}
 	}
 	if p.match(tokens.NIL) {
-		return expressions.Literal{Value: nil}
+		return expressions.Literal{ID: p.nextID(), Token: p.previous(), Value: nil}
 	}
 
 	if p.match(tokens.NUMBER, tokens.STRING) {
-		return expressions.Literal{Value: p.previous().Literal}
+		return expressions.Literal{ID: p.nextID(), Token: p.previous(), Value: p.previous().Literal}
+	}
+
+	if p.match(tokens.SUPER) {
+		keyword := p.previous()
+		p.consume(tokens.DOT, "Expect '.' after 'super'.")
+		method, _ := p.consume(tokens.IDENTIFIER, "Expect superclass method name.")
+		return expressions.Super{ID: p.nextID(), Keyword: keyword, Method: method, Binding: &expressions.Binding{}}
+	}
+
+	if p.match(tokens.THIS) {
+		return expressions.This{ID: p.nextID(), Keyword: p.previous(), Binding: &expressions.Binding{}}
 	}
 
 	if p.match(tokens.IDENTIFIER) {
-		return expressions.Variable{Name: p.previous()}
+		return expressions.Variable{ID: p.nextID(), Name: p.previous(), Binding: &expressions.Binding{}}
+	}
+
+	if p.match(tokens.LEFT_BRACKET) {
+		return p.list()
+	}
+
+	// a brace starting a statement is a block, so map literals only appear inside expressions
+	if p.match(tokens.LEFT_BRACE) {
+		return p.mapLiteral()
 	}
 
 	if p.match(tokens.LEFT_PAREN) {
+		leftParen := p.previous()
 		expr := p.expression()
-		p.consume(tokens.RIGHT_PAREN, "Expect ')' after expression.")
-		return expressions.Grouping{Expression: expr}
+		rightParen, _ := p.consume(tokens.RIGHT_PAREN, "Expect ')' after expression.")
+		return expressions.Grouping{ID: p.nextID(), LeftParen: leftParen, Expression: expr, RightParen: rightParen}
 	}
 
-	// TODO: revist this, not totally sure yet
+	// a placeholder keeps the tree free of nil expressions; the error keeps it from being run
 	curr := p.peek()
-	p.errReporter.AddError(curr.LineNum, 0, fmt.Sprintf("unknown primary expression: %s", curr.Lexeme))
-	p.synchronize()
-
-	// important to tell error reporter and avoid executing the expression tree.
-	// otherwise might nil pointer dereference
-	return nil
+	p.fail(curr, "Expect expression.")
+	return expressions.Literal{ID: p.nextID(), Token: curr, Value: nil}
 }
 
 func (p *parser) consume(t tokens.TokenType, message string) (tokens.Token, error) {
@@ -429,27 +610,45 @@ func (p *parser) consume(t tokens.TokenType, message string) (tokens.Token, erro
 		return t, nil
 	}
 
-	// err handling begins
-	curr := p.peek()
+	p.fail(p.peek(), message)
+	return tokens.Token{}, errors.New(message)
+}
 
-	// TODO: at char count number
-	p.errReporter.AddError(curr.LineNum, 0, message)
+// fail reports an error the current statement can't be parsed past.
+// Further errors are ignored until declaration has synchronized.
+func (p *parser) fail(token tokens.Token, message string, hints ...string) {
+	p.error(token, message, hints...)
+	p.panicMode = true
+}
 
-	p.synchronize()
-	return tokens.Token{}, errors.New(message)
+// error reports an error the parser can carry on from, such as an invalid assignment target.
+func (p *parser) error(token tokens.Token, message string, hints ...string) {
+	if p.panicMode {
+		return
+	}
+	p.errReporter.AddError(Diagnostic{
+		Category: CategoryParse,
+		Span:     token.Span(),
+		Message:  message,
+		Hints:    hints,
+	})
 }
 
 // synchronize moves the parser along to the next statement after an error was found
+// and leaves panic mode. It also stops before a '}' so the enclosing block still ends there.
 func (p *parser) synchronize() {
-	p.advance()
+	p.panicMode = false
 	for !p.isAtEnd() {
 		if p.previous().TokenType == tokens.SEMICOLON {
 			return
 		}
 
 		curr := p.peek()
+		if curr.TokenType == tokens.RIGHT_BRACE {
+			return
+		}
 
-		for _, t := range []tokens.TokenType{tokens.CLASS, tokens.FOR, tokens.FUN, tokens.IF, tokens.PRINT, tokens.RETURN, tokens.VAR, tokens.WHILE} {
+		for _, t := range []tokens.TokenType{tokens.CLASS, tokens.FOR, tokens.FUN, tokens.IF, tokens.IMPORT, tokens.PRINT, tokens.RETURN, tokens.THROW, tokens.TRY, tokens.VAR, tokens.WHILE} {
 			if t == curr.TokenType {
 				return
 			}
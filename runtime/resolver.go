@@ -2,24 +2,65 @@ package runtime
 
 import (
 	"errors"
-	"fmt"
 
 	"github.com/awgraves/go-lox/expressions"
 	"github.com/awgraves/go-lox/statements"
 	"github.com/awgraves/go-lox/tokens"
 )
 
+type functionType int
+
+const (
+	functionNone functionType = iota
+	functionFunction
+	functionInitializer
+	functionMethod
+)
+
+type classType int
+
+const (
+	classNone classType = iota
+	classClass
+	classSubclass
+)
+
+// scope holds the local variables declared in a block, function body or catch clause.
+// Variables get consecutive slots, matching the order the interpreter defines them in.
+type scope struct {
+	variables map[string]*variable
+	slots     int
+}
+
+type variable struct {
+	slot    int
+	defined bool // false while the variable's initializer is resolved
+}
+
+func newScope() *scope {
+	return &scope{variables: make(map[string]*variable)}
+}
+
+// add declares the name in the next free slot, shadowing any earlier variable of that name.
+func (s *scope) add(name string, defined bool) {
+	s.variables[name] = &variable{slot: s.slots, defined: defined}
+	s.slots++
+}
+
 type resolver struct {
-	interpreter interpreter
-	scopes      []map[string]bool
-	errReporter ErrorReporter
+	scopes          []*scope
+	errReporter     ErrorReporter
+	currentFunction functionType
+	currentClass    classType
+	loopDepth       int // loops enclosing the current statement within the current function
+	tracer          *tracer
 }
 
-func newResolver(i interpreter) *resolver {
+func newResolver(i *interpreter) *resolver {
 	return &resolver{
-		interpreter: i,
 		errReporter: i.errReporter,
-		scopes:      []map[string]bool{},
+		scopes:      []*scope{},
+		tracer:      i.tracer,
 	}
 }
 
@@ -28,13 +69,24 @@ func (r *resolver) resolveStmts(stmts []statements.Stmt) error {
 	for _, s := range stmts {
 		err = r.resolveStmt(s)
 		if err != nil {
-			r.errReporter.AddError(0, 0, err.Error())
+			r.reportError(err)
 			return err
 		}
 	}
 	return err
 }
 
+func (r *resolver) reportError(err error) {
+	d := Diagnostic{Category: CategoryResolve, Message: err.Error()}
+
+	var resolveErr *resolveError
+	if errors.As(err, &resolveErr) {
+		d.Span = resolveErr.span
+		d.Hints = resolveErr.hints
+	}
+	r.errReporter.AddError(d)
+}
+
 func (r *resolver) resolveStmt(stmt statements.Stmt) error {
 	err := stmt.Accept(r)
 	return err
@@ -57,49 +109,66 @@ func (r *resolver) resolveExpr(expr expressions.Expression) error {
 }
 
 func (r *resolver) beginScope() {
-	newScope := make(map[string]bool)
-	r.scopes = append([]map[string]bool{newScope}, r.scopes...)
-	fmt.Println("beginning scope")
-	fmt.Printf("total scopes: %d\n", len(r.scopes))
+	r.scopes = append([]*scope{newScope()}, r.scopes...)
+	if r.tracer != nil {
+		r.tracer.emit(PhaseResolve, "begin scope", tokens.Span{}, map[string]interface{}{"scopes": len(r.scopes)})
+	}
 }
 
 func (r *resolver) endScope() {
 	r.scopes = r.scopes[1:]
-	fmt.Println("ending scope")
-	fmt.Printf("total scopes: %d\n", len(r.scopes))
+	if r.tracer != nil {
+		r.tracer.emit(PhaseResolve, "end scope", tokens.Span{}, map[string]interface{}{"scopes": len(r.scopes)})
+	}
 }
 
 func (r *resolver) declare(name tokens.Token) {
 	if len(r.scopes) == 0 {
 		return
 	}
-	fmt.Printf("declaring %s\n", name.Lexeme)
-	scope := r.scopes[0]
-	scope[name.Lexeme] = false
+	r.scopes[0].add(name.Lexeme, false)
+	if r.tracer != nil {
+		r.tracer.emit(PhaseResolve, "declare", name.Span(), map[string]interface{}{
+			"name": name.Lexeme,
+			"slot": r.scopes[0].variables[name.Lexeme].slot,
+		})
+	}
 }
 
 func (r *resolver) define(name tokens.Token) {
 	if len(r.scopes) == 0 {
 		return
 	}
-	fmt.Printf("defining %s\n", name.Lexeme)
-	scope := r.scopes[0]
-	scope[name.Lexeme] = true
+	r.scopes[0].variables[name.Lexeme].defined = true
 }
 
-func (r *resolver) resolveLocal(expr expressions.Expression, name tokens.Token) {
+// resolveLocal records in the reference's binding where the local variable it names lives.
+// References to globals are left unresolved.
+func (r *resolver) resolveLocal(binding *expressions.Binding, name tokens.Token) {
 	for i := 0; i < len(r.scopes); i++ {
-		scope := r.scopes[i]
-		if _, ok := scope[name.Lexeme]; ok {
-			fmt.Printf("%s found at level: %d\n", name.Lexeme, i)
-			r.interpreter.resolve(expr, i)
+		if v, ok := r.scopes[i].variables[name.Lexeme]; ok {
+			*binding = expressions.Binding{Resolved: true, Depth: i, Slot: v.slot}
+			if r.tracer != nil {
+				r.tracer.emit(PhaseResolve, "local", name.Span(), map[string]interface{}{
+					"name":  name.Lexeme,
+					"depth": i,
+					"slot":  v.slot,
+				})
+			}
 			return
 		}
 	}
-	fmt.Println("NOT FOUND")
+	if r.tracer != nil {
+		r.tracer.emit(PhaseResolve, "global", name.Span(), map[string]interface{}{"name": name.Lexeme})
+	}
 }
 
-func (r *resolver) resolveFunction(fun statements.FunctionStmt) {
+func (r *resolver) resolveFunction(fun statements.FunctionStmt, ftype functionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = ftype
+	enclosingLoopDepth := r.loopDepth
+	r.loopDepth = 0
+
 	r.beginScope()
 	for _, p := range fun.Params {
 		r.declare(p)
@@ -107,6 +176,54 @@ func (r *resolver) resolveFunction(fun statements.FunctionStmt) {
 	}
 	r.resolveStmts(fun.Body)
 	r.endScope()
+
+	r.currentFunction = enclosingFunction
+	r.loopDepth = enclosingLoopDepth
+}
+
+func (r *resolver) VisitClassStmt(stmt statements.ClassStmt) error {
+	enclosingClass := r.currentClass
+	r.currentClass = classClass
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+			r.currentClass = enclosingClass
+			return newResolveError(stmt.Superclass.Span(), "A class can't inherit from itself.")
+		}
+
+		r.currentClass = classSubclass
+		err := r.resolveExpr(*stmt.Superclass)
+		if err != nil {
+			r.currentClass = enclosingClass
+			return err
+		}
+
+		r.beginScope()
+		r.scopes[0].add("super", true)
+	}
+
+	r.beginScope()
+	r.scopes[0].add("this", true)
+
+	for _, method := range stmt.Methods {
+		declaration := functionMethod
+		if method.Name.Lexeme == "init" {
+			declaration = functionInitializer
+		}
+		r.resolveFunction(method, declaration)
+	}
+
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil
 }
 
 func (r *resolver) VisitExpressionStmt(stmt statements.ExpStmt) error {
@@ -117,7 +234,7 @@ func (r *resolver) VisitExpressionStmt(stmt statements.ExpStmt) error {
 func (r *resolver) VisitFunctionStmt(stmt statements.FunctionStmt) error {
 	r.declare(stmt.Name)
 	r.define(stmt.Name)
-	r.resolveFunction(stmt)
+	r.resolveFunction(stmt, functionFunction)
 	return nil
 }
 
@@ -127,15 +244,21 @@ func (r *resolver) VisitPrintStmt(stmt statements.PrintStmt) error {
 }
 
 func (r *resolver) VisitReturnStmt(stmt statements.ReturnStmt) error {
+	if r.currentFunction == functionNone {
+		return newResolveError(stmt.Keyword.Span(), "Can't return from top-level code.")
+	}
+
 	var err error
 	if stmt.Value != nil {
+		if r.currentFunction == functionInitializer {
+			return newResolveError(stmt.Keyword.Span(), "Can't return a value from an initializer.")
+		}
 		err = r.resolveExpr(stmt.Value)
 	}
 	return err
 }
 
 func (r *resolver) VisitVarStmt(stmt statements.VarStmt) error {
-	fmt.Println("VAR STATEMENT")
 	r.declare(stmt.Name)
 	if stmt.Initializer != nil {
 		err := r.resolveExpr(stmt.Initializer)
@@ -155,8 +278,14 @@ func (r *resolver) VisitBlock(stmt statements.Block) error {
 }
 
 func (r *resolver) VisitIfStmt(stmt statements.IfStmt) error {
-	r.resolveExpr(stmt.Condition)
-	r.resolveStmt(stmt.ThenBranch)
+	err := r.resolveExpr(stmt.Condition)
+	if err != nil {
+		return err
+	}
+	err = r.resolveStmt(stmt.ThenBranch)
+	if err != nil {
+		return err
+	}
 	if stmt.ElseBranch != nil {
 		err := r.resolveStmt(stmt.ElseBranch)
 		if err != nil {
@@ -167,19 +296,37 @@ func (r *resolver) VisitIfStmt(stmt statements.IfStmt) error {
 }
 
 func (r *resolver) VisitWhileStmt(stmt statements.WhileStmt) error {
-	fmt.Println("while statement")
 	err := r.resolveExpr(stmt.Condition)
 	if err != nil {
 		return err
 	}
+	r.loopDepth++
 	err = r.resolveStmt(stmt.Body)
+	r.loopDepth--
 	if err != nil {
 		return err
 	}
+	if stmt.Increment != nil {
+		return r.resolveExpr(stmt.Increment)
+	}
 
 	return nil
 }
 
+func (r *resolver) VisitBreakStmt(stmt statements.BreakStmt) error {
+	if r.loopDepth == 0 {
+		return newResolveError(stmt.Keyword.Span(), "Can't use 'break' outside of a loop.")
+	}
+	return nil
+}
+
+func (r *resolver) VisitContinueStmt(stmt statements.ContinueStmt) error {
+	if r.loopDepth == 0 {
+		return newResolveError(stmt.Keyword.Span(), "Can't use 'continue' outside of a loop.")
+	}
+	return nil
+}
+
 func (r *resolver) VisitBinary(expr expressions.Binary) (interface{}, error) {
 	err := r.resolveExpr(expr.Left)
 	if err != nil {
@@ -205,31 +352,28 @@ func (r *resolver) VisitUnary(expr expressions.Unary) (interface{}, error) {
 
 func (r *resolver) VisitVariable(expr expressions.Variable) (interface{}, error) {
 	if len(r.scopes) > 0 {
-		scope := r.scopes[0]
-		v, ok := scope[expr.Name.Lexeme]
-		if ok && !v {
+		v, ok := r.scopes[0].variables[expr.Name.Lexeme]
+		if ok && !v.defined {
 			// report the error
-			err := errors.New("Can't read local variable in its own initializer.")
+			err := newResolveError(expr.Span(), "Can't read local variable in its own initializer.")
 			return nil, err
 		}
 	}
 
-	r.resolveLocal(expr, expr.Name)
+	r.resolveLocal(expr.Binding, expr.Name)
 	return nil, nil
 }
 
 func (r *resolver) VisitAssign(expr expressions.Assign) (interface{}, error) {
-	fmt.Printf("assigning %s\n", expr.Name.Lexeme)
 	err := r.resolveExpr(expr.Value)
 	if err != nil {
 		return nil, err
 	}
-	r.resolveLocal(expr, expr.Name)
+	r.resolveLocal(expr.Binding, expr.Name)
 	return nil, nil
 }
 
 func (r *resolver) VisitLogical(expr expressions.Logical) (interface{}, error) {
-	fmt.Println("LOGICAL")
 	err := r.resolveExpr(expr.Left)
 	if err != nil {
 		return nil, err
@@ -255,3 +399,114 @@ func (r *resolver) VisitCall(expr expressions.Call) (interface{}, error) {
 	}
 	return nil, nil
 }
+
+func (r *resolver) VisitGet(expr expressions.Get) (interface{}, error) {
+	err := r.resolveExpr(expr.Object)
+	return nil, err
+}
+
+func (r *resolver) VisitSet(expr expressions.Set) (interface{}, error) {
+	err := r.resolveExpr(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Object)
+	return nil, err
+}
+
+func (r *resolver) VisitThis(expr expressions.This) (interface{}, error) {
+	if r.currentClass == classNone {
+		return nil, newResolveError(expr.Span(), "Can't use 'this' outside of a class.")
+	}
+
+	r.resolveLocal(expr.Binding, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) VisitSuper(expr expressions.Super) (interface{}, error) {
+	if r.currentClass == classNone {
+		return nil, newResolveError(expr.Keyword.Span(), "Can't use 'super' outside of a class.")
+	}
+	if r.currentClass != classSubclass {
+		return nil, newResolveError(
+			expr.Keyword.Span(),
+			"Can't use 'super' in a class with no superclass.",
+			"declare a superclass with 'class Name < Superclass'",
+		)
+	}
+
+	r.resolveLocal(expr.Binding, expr.Keyword)
+	return nil, nil
+}
+
+func (r *resolver) VisitList(expr expressions.List) (interface{}, error) {
+	err := r.resolveExprs(expr.Elements)
+	return nil, err
+}
+
+func (r *resolver) VisitIndex(expr expressions.Index) (interface{}, error) {
+	err := r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Index)
+	return nil, err
+}
+
+func (r *resolver) VisitSetIndex(expr expressions.SetIndex) (interface{}, error) {
+	err := r.resolveExpr(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	err = r.resolveExpr(expr.Index)
+	return nil, err
+}
+
+func (r *resolver) VisitMap(expr expressions.Map) (interface{}, error) {
+	for n := range expr.Keys {
+		err := r.resolveExpr(expr.Keys[n])
+		if err != nil {
+			return nil, err
+		}
+		err = r.resolveExpr(expr.Values[n])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (r *resolver) VisitThrowStmt(stmt statements.ThrowStmt) error {
+	return r.resolveExpr(stmt.Value)
+}
+
+func (r *resolver) VisitTryStmt(stmt statements.TryStmt) error {
+	err := r.resolveStmt(stmt.Body)
+	if err != nil {
+		return err
+	}
+
+	if stmt.Catch != nil {
+		r.beginScope()
+		r.declare(stmt.Catch.Name)
+		r.define(stmt.Catch.Name)
+		r.resolveStmts(stmt.Catch.Body)
+		r.endScope()
+	}
+
+	if stmt.Finally != nil {
+		return r.resolveStmt(*stmt.Finally)
+	}
+	return nil
+}
+
+func (r *resolver) VisitImportStmt(stmt statements.ImportStmt) error {
+	if len(r.scopes) != 0 || r.currentFunction != functionNone {
+		return newResolveError(stmt.Keyword.Span(), "Can only import at the top level of a script.")
+	}
+	return nil
+}
@@ -1,91 +1,91 @@
 package runtime
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 )
 
-func RunFile(filePath string) {
-	bytes, err := os.ReadFile(filePath)
+func RunFile(filePath string, opts ...Option) {
+	interp := New(opts...)
+
+	bytes, err := interp.fs.ReadFile(filePath)
 	if err != nil {
-		printError(fmt.Sprintf("Invalid file path: %s\n", filePath))
+		printError(interp.stderr, interp.color, fmt.Sprintf("Invalid file path: %s\n", filePath))
 		os.Exit(1)
 	}
 
-	run(string(bytes))
+	defer interp.modules.enter(filePath)()
+	run(interp, string(bytes), filePath)
 }
 
-func RunPrompt() {
-	fmt.Print(GREEN)
-	fmt.Println("Lox Shell v0.0")
-	fmt.Print(BLUE)
-	fmt.Println("Type 'exit' to quit.")
-	fmt.Print(RESET_COLOR)
-	fmt.Println()
+func RunPrompt(opts ...Option) {
+	interp := New(opts...)
+
+	fmt.Fprintln(interp.stdout, paint(interp.color, GREEN, "Lox Shell v0.0"))
+	fmt.Fprintln(interp.stdout, paint(interp.color, BLUE, "Type 'exit' to quit."))
+	fmt.Fprintln(interp.stdout)
 
-	promptLoop()
+	promptLoop(interp)
 }
 
-func promptLoop() {
-	scanner := bufio.NewScanner(os.Stdin)
-	for {
-		fmt.Print("> ")
-		scanner.Scan()
-		line := scanner.Text()
+// promptLoop keeps a single interpreter for the whole session
+// so globals and resolved locals survive from one line to the next.
+// Lines are read from the same reader as readLine, so a script reading
+// input consumes the lines following it instead of the shell.
+// Each line is its own source, named <repl:N>, so an error raised later in
+// a function defined on an earlier line still points into that line.
+func promptLoop(interp *Interpreter) {
+	for entry := 1; ; {
+		fmt.Fprint(interp.stdout, "> ")
+		line, err := interp.stdin.ReadString('\n')
+		if err != nil && line == "" {
+			break
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
 		if line == "exit" {
 			break
 		}
 		if line == "" {
 			continue
 		}
-		run(line)
+		run(interp, line, fmt.Sprintf("<repl:%d>", entry))
+		entry++
 	}
 }
 
-func run(input string) {
-	errReporter := newBasicErrorReporter()
-	scanner := newScanner(input, errReporter)
-	scanner.ScanTokens()
+func run(interp *Interpreter, input string, file string) {
+	reportErrors := func(header string) {
+		printError(interp.stderr, interp.color, header)
+		interp.ErrorReporter().Report()
+		fmt.Fprintln(interp.stderr)
+	}
 
-	if errReporter.HasError() {
-		printError("Errors found - runtime would not attempt to execute this code.")
-		errReporter.Report()
-		fmt.Println()
+	statements, err := interp.parse(input, file)
+	if err != nil {
+		reportErrors("Errors found - runtime would not attempt to execute this code.")
 		return
 	}
 
-	parser := newParser(scanner.Tokens, errReporter)
-	statements := parser.parse()
-
-	if errReporter.HasError() {
-		printError("Errors found - runtime would not attempt to execute this code.")
-		errReporter.Report()
-		fmt.Println()
+	_, err = interp.Run(statements)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		// the command line is the host here, so the script's exit ends the process
+		os.Exit(exitErr.Code)
+	}
+	if errors.Is(err, ErrResolve) {
+		reportErrors("Parse error")
 		return
 	}
-
-	interpreter := newIntepreter(errReporter)
-
-	fmt.Println(statements)
-
-	resolver := newResolver(*interpreter)
-	resolver.resolveStmts(statements)
-	if errReporter.HasError() {
-		printError("Parse error")
-		errReporter.Report()
-		fmt.Println()
+	if errors.Is(err, ErrCompile) {
+		reportErrors("Compile error")
 		return
 	}
-
-	interpreter.interpret(statements)
-
-	if errReporter.HasError() {
-		printError("Runtime error")
-		errReporter.Report()
-		fmt.Println()
+	if err != nil {
+		reportErrors("Runtime error")
 		return
 	}
 
-	fmt.Println()
+	fmt.Fprintln(interp.stdout)
 }
@@ -9,30 +9,66 @@ import (
 
 type Scanner struct {
 	source      []rune
+	offsets     []int // byte offset of each rune in source, plus the total length
+	file        string
 	Tokens      []*tokens.Token
 	start       int
+	startPos    tokens.Position
 	current     int
 	line        int
-	pos         int
+	column      int
 	errReporter ErrorReporter
+	tracer      *tracer
 }
 
-func newScanner(source string, errReporter ErrorReporter) *Scanner {
+func newScanner(source string, file string, errReporter ErrorReporter, tracer *tracer) *Scanner {
+	runes := []rune{}
+	offsets := []int{}
+	for offset, r := range source {
+		runes = append(runes, r)
+		offsets = append(offsets, offset)
+	}
+	offsets = append(offsets, len(source))
+
 	return &Scanner{
-		source:      []rune(source),
+		source:      runes,
+		offsets:     offsets,
+		file:        file,
 		Tokens:      []*tokens.Token{},
 		line:        1,
-		pos:         0,
+		column:      1,
 		errReporter: errReporter,
+		tracer:      tracer,
 	}
 }
 
 func (s *Scanner) ScanTokens() {
 	for !s.isAtEnd() {
 		s.start = s.current
+		s.startPos = s.position()
 		s.scanToken()
 	}
-	s.Tokens = append(s.Tokens, tokens.NewToken(tokens.EOF, "", nil, s.line))
+	end := s.position()
+	s.Tokens = append(s.Tokens, tokens.NewToken(tokens.EOF, "", nil, end, end))
+
+	if s.tracer != nil {
+		for _, token := range s.Tokens {
+			s.tracer.emit(PhaseScan, "token", token.Span(), map[string]interface{}{
+				"type":   token.TokenType.String(),
+				"lexeme": token.Lexeme,
+			})
+		}
+	}
+}
+
+// position is the location of the next rune to be scanned.
+func (s *Scanner) position() tokens.Position {
+	return tokens.Position{
+		File:   s.file,
+		Line:   s.line,
+		Column: s.column,
+		Offset: s.offsets[s.current],
+	}
 }
 
 func (s *Scanner) scanToken() {
@@ -50,9 +86,18 @@ func (s *Scanner) scanToken() {
 	case '}':
 		s.addToken(tokens.RIGHT_BRACE, nil)
 		break
+	case '[':
+		s.addToken(tokens.LEFT_BRACKET, nil)
+		break
+	case ']':
+		s.addToken(tokens.RIGHT_BRACKET, nil)
+		break
 	case ',':
 		s.addToken(tokens.COMMA, nil)
 		break
+	case ':':
+		s.addToken(tokens.COLON, nil)
+		break
 	case '.':
 		s.addToken(tokens.DOT, nil)
 		break
@@ -119,7 +164,6 @@ func (s *Scanner) scanToken() {
 	case '\t':
 		break
 	case '\n':
-		s.setNewLine()
 		break
 
 	case '"':
@@ -135,27 +179,18 @@ func (s *Scanner) scanToken() {
 			s.handleIdentifier()
 			break
 		}
-		s.errReporter.AddError(s.line, s.pos, fmt.Sprintf("Unexpected character '%v'", string(c)))
+		s.error(fmt.Sprintf("Unexpected character '%v'", string(c)))
 	}
 }
 
 func (s *Scanner) handleMultiLineComment() {
-	startLine := s.line
-	startPos := s.pos
-
 	for {
 		if s.isAtEnd() {
-			s.errReporter.AddError(startLine, startPos, "Unterminated multi-line comment")
+			s.error("Unterminated multi-line comment", "close the comment with '*/'")
 			break
 		}
 
 		next := s.peek()
-		if next == '\n' {
-			s.setNewLine()
-			s.advance()
-			continue
-		}
-
 		if next == '*' && s.peekNext() == '/' {
 			s.advance()
 			s.advance()
@@ -166,11 +201,6 @@ func (s *Scanner) handleMultiLineComment() {
 	}
 }
 
-func (s *Scanner) setNewLine() {
-	s.line++
-	s.pos = 0
-}
-
 func (s *Scanner) handleIdentifier() {
 	for s.isAlphaNumeric(s.peek()) {
 		s.advance()
@@ -212,32 +242,23 @@ func (s *Scanner) handleNum() {
 		}
 	}
 
-	num, err := strconv.ParseFloat(string(s.source[s.start:s.current]), 32)
-	// TODO: come back to this
+	// only digits were consumed, so the sole possible failure is a literal too large for a float64
+	num, err := strconv.ParseFloat(string(s.source[s.start:s.current]), 64)
 	if err != nil {
-		panic("unable to parse what should be a number")
+		s.error("Number literal is too large.")
+		return
 	}
 
 	s.addToken(tokens.NUMBER, num)
 }
 
 func (s *Scanner) handleString() {
-	strStartpos := s.pos
-	strStartline := s.line
-
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.setNewLine()
-		}
 		s.advance()
 	}
 
 	if s.isAtEnd() {
-		s.errReporter.AddError(
-			strStartline,
-			strStartpos,
-			"Unterminated string.",
-		)
+		s.error("Unterminated string.", "close the string with '\"'")
 		return
 	}
 
@@ -270,18 +291,34 @@ func (s *Scanner) match(exp rune) bool {
 	if s.isAtEnd() || s.source[s.current] != exp {
 		return false
 	}
-	s.current++
+	s.advance()
 	return true
 }
 
+// advance consumes the next rune, keeping the line and column up to date.
 func (s *Scanner) advance() rune {
 	c := s.source[s.current]
 	s.current++
-	s.pos++
+	if c == '\n' {
+		s.line++
+		s.column = 1
+	} else {
+		s.column++
+	}
 	return c
 }
 
 func (s *Scanner) addToken(tt tokens.TokenType, literal interface{}) {
 	str := string(s.source[s.start:s.current])
-	s.Tokens = append(s.Tokens, tokens.NewToken(tt, str, literal, s.line))
+	s.Tokens = append(s.Tokens, tokens.NewToken(tt, str, literal, s.startPos, s.position()))
+}
+
+// error reports a problem with the token currently being scanned.
+func (s *Scanner) error(message string, hints ...string) {
+	s.errReporter.AddError(Diagnostic{
+		Category: CategoryScan,
+		Span:     tokens.Span{Start: s.startPos, End: s.position()},
+		Message:  message,
+		Hints:    hints,
+	})
 }
@@ -0,0 +1,259 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Strings are indexed by Unicode code point, the same unit the scanner reads
+// source in, so "é" has length 1 whatever its UTF-8 encoding.
+var stringNatives = []nativeDef{
+	{"substring", 3, stringSubstring},
+	{"indexOf", 2, stringIndexOf},
+	{"split", 2, stringSplit},
+	{"join", 2, stringJoin},
+	{"replace", 3, stringReplace},
+	{"upper", 1, stringUpper},
+	{"lower", 1, stringLower},
+	{"trim", 1, stringTrim},
+	{"startsWith", 2, stringStartsWith},
+	{"endsWith", 2, stringEndsWith},
+	{"repeat", 2, stringRepeat},
+	{"charCode", 2, stringCharCode},
+	{"fromCharCode", 1, stringFromCharCode},
+}
+
+// maxStringBytes bounds the strings natives build, so a script can't exhaust the host's memory with one call.
+const maxStringBytes = 1 << 28
+
+func argString(fn string, args []Value, n int) (string, error) {
+	s, ok := args[n].(string)
+	if !ok {
+		return "", fmt.Errorf("%s expects a string as argument %d but got %s.", fn, n+1, typeName(args[n]))
+	}
+	return s, nil
+}
+
+// argInteger checks the argument is a whole number that fits in an int.
+func argInteger(fn string, args []Value, n int) (int, error) {
+	num, err := argNumber(fn, args, n)
+	if err != nil {
+		return 0, err
+	}
+	if num != math.Trunc(num) {
+		return 0, fmt.Errorf("%s expects an integer as argument %d but got %s.", fn, n+1, stringify(num))
+	}
+	if num < math.MinInt || num >= -math.MinInt {
+		return 0, fmt.Errorf("%s got an integer out of range as argument %d: %s.", fn, n+1, stringify(num))
+	}
+	return int(num), nil
+}
+
+// stringIndex checks the argument is a code point index in [0, length].
+func stringIndex(fn string, args []Value, n int, length int) (int, error) {
+	i, err := argInteger(fn, args, n)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i > length {
+		return 0, fmt.Errorf("Index %d out of bounds for string of length %d.", i, length)
+	}
+	return i, nil
+}
+
+// stringSubstring returns the code points from start up to, but not including, end.
+func stringSubstring(args []Value) (Value, error) {
+	s, err := argString("substring", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	start, err := stringIndex("substring", args, 1, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	end, err := stringIndex("substring", args, 2, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("Substring start %d is after its end %d.", start, end)
+	}
+	return string(runes[start:end]), nil
+}
+
+// stringIndexOf returns the code point index of the first occurrence of the substring, or -1.
+func stringIndexOf(args []Value) (Value, error) {
+	s, err := argString("indexOf", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := argString("indexOf", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return float64(-1), nil
+	}
+	return float64(utf8.RuneCountInString(s[:i])), nil
+}
+
+// stringSplit returns a list of the parts between separators.
+// An empty separator splits the string into its code points.
+func stringSplit(args []Value) (Value, error) {
+	s, err := argString("split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := argString("split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(s, sep)
+	elements := make([]Value, len(parts))
+	for i, part := range parts {
+		elements[i] = part
+	}
+	return NewLoxList(elements), nil
+}
+
+// stringJoin concatenates a list of strings with the separator between them.
+func stringJoin(args []Value) (Value, error) {
+	list, err := argList("join", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := argString("join", args, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, len(list.Elements))
+	for i, element := range list.Elements {
+		part, ok := element.(string)
+		if !ok {
+			return nil, fmt.Errorf("join expects a list of strings but element %d is a %s.", i, typeName(element))
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// stringReplace replaces every occurrence of old with new.
+func stringReplace(args []Value) (Value, error) {
+	s, err := argString("replace", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	old, err := argString("replace", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := argString("replace", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(s, old, replacement), nil
+}
+
+func stringUpper(args []Value) (Value, error) {
+	s, err := argString("upper", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(s), nil
+}
+
+func stringLower(args []Value) (Value, error) {
+	s, err := argString("lower", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(s), nil
+}
+
+// stringTrim removes leading and trailing white space.
+func stringTrim(args []Value) (Value, error) {
+	s, err := argString("trim", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+func stringStartsWith(args []Value) (Value, error) {
+	s, err := argString("startsWith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := argString("startsWith", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(s, prefix), nil
+}
+
+func stringEndsWith(args []Value) (Value, error) {
+	s, err := argString("endsWith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := argString("endsWith", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(s, suffix), nil
+}
+
+// stringRepeat returns the string repeated count times.
+func stringRepeat(args []Value) (Value, error) {
+	s, err := argString("repeat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	count, err := argInteger("repeat", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("Can't repeat a string %d times.", count)
+	}
+	if count > 0 && len(s) > maxStringBytes/count {
+		return nil, fmt.Errorf("Can't repeat a string %d times; the result would be over %d bytes.", count, maxStringBytes)
+	}
+	return strings.Repeat(s, count), nil
+}
+
+// stringCharCode returns the code point at the index.
+func stringCharCode(args []Value) (Value, error) {
+	s, err := argString("charCode", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	i, err := stringIndex("charCode", args, 1, len(runes))
+	if err != nil {
+		return nil, err
+	}
+	if i == len(runes) {
+		return nil, fmt.Errorf("Index %d out of bounds for string of length %d.", i, len(runes))
+	}
+	return float64(runes[i]), nil
+}
+
+// stringFromCharCode returns the string of the single code point.
+func stringFromCharCode(args []Value) (Value, error) {
+	code, err := argInteger("fromCharCode", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.ValidRune(rune(code)) || code != int(rune(code)) {
+		return nil, fmt.Errorf("%d is not a valid character code.", code)
+	}
+	return string(rune(code)), nil
+}
@@ -0,0 +1,119 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/awgraves/go-lox/statements"
+	"github.com/awgraves/go-lox/tokens"
+)
+
+// TracePhase names the stage of the pipeline a trace event comes from.
+type TracePhase string
+
+const (
+	PhaseScan      TracePhase = "scan"
+	PhaseParse     TracePhase = "parse"
+	PhaseResolve   TracePhase = "resolve"
+	PhaseInterpret TracePhase = "interpret"
+)
+
+// TraceFormat selects how trace events are written.
+type TraceFormat int
+
+const (
+	// TraceText writes one human readable line per event.
+	TraceText TraceFormat = iota
+	// TraceJSON writes one JSON object per line.
+	TraceJSON
+)
+
+// ParseTraceFormat returns the format called "text" or "json".
+func ParseTraceFormat(name string) (TraceFormat, error) {
+	switch name {
+	case "text":
+		return TraceText, nil
+	case "json":
+		return TraceJSON, nil
+	}
+	return 0, fmt.Errorf("unknown trace format %q", name)
+}
+
+// TraceEvent is one step taken by the scanner, parser, resolver or interpreter.
+// Line and Column are zero for events without a place in the source, such as a scope ending.
+type TraceEvent struct {
+	Phase  TracePhase             `json:"phase"`
+	Event  string                 `json:"event"`
+	File   string                 `json:"file,omitempty"`
+	Line   int                    `json:"line,omitempty"`
+	Column int                    `json:"column,omitempty"`
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// String renders the event as it appears in the text format, e.g.
+// "resolve local test.lx:3:9 depth=1 name=x slot=0".
+func (e TraceEvent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", e.Phase, e.Event)
+	if e.Line > 0 {
+		b.WriteString(" ")
+		if e.File != "" {
+			fmt.Fprintf(&b, "%s:", e.File)
+		}
+		fmt.Fprintf(&b, "%d:%d", e.Line, e.Column)
+	}
+
+	keys := make([]string, 0, len(e.Fields))
+	for key := range e.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if s, ok := e.Fields[key].(string); ok {
+			fmt.Fprintf(&b, " %s=%q", key, s)
+		} else {
+			fmt.Fprintf(&b, " %s=%v", key, e.Fields[key])
+		}
+	}
+	return b.String()
+}
+
+// WithTrace writes an event to w for every token scanned, statement parsed,
+// variable resolved and statement or call executed. Tracing is off by default.
+// The bytecode VM executes no statements, so it only traces calls.
+func WithTrace(w io.Writer, format TraceFormat) Option {
+	return func(in *Interpreter) {
+		in.tracer = &tracer{w: w, format: format}
+	}
+}
+
+// tracer writes trace events. It is nil when tracing is off, so callers check
+// for nil before building an event and no work is done for it.
+type tracer struct {
+	w      io.Writer
+	format TraceFormat
+}
+
+func (t *tracer) emit(phase TracePhase, event string, span tokens.Span, fields map[string]interface{}) {
+	e := TraceEvent{
+		Phase:  phase,
+		Event:  event,
+		File:   span.Start.File,
+		Line:   span.Start.Line,
+		Column: span.Start.Column,
+		Fields: fields,
+	}
+	if t.format == TraceJSON {
+		json.NewEncoder(t.w).Encode(e)
+		return
+	}
+	fmt.Fprintln(t.w, e.String())
+}
+
+// statementKind is the name of the statement's type, such as "VarStmt".
+func statementKind(stmt statements.Stmt) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", stmt), "statements.")
+}
@@ -0,0 +1,648 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/awgraves/go-lox/tokens"
+)
+
+type vmFunction struct {
+	name         string // empty for the top-level script
+	arity        int
+	upvalueCount int
+	chunk        chunk
+}
+
+func (f *vmFunction) String() string {
+	if f.name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", f.name)
+}
+
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+	globals  map[string]Value // of the script or module the closure was created in
+}
+
+func (c *vmClosure) String() string {
+	return c.function.String()
+}
+
+// vmUpvalue is a variable captured by a closure.
+// While open it refers to a stack slot; once the slot goes out of scope the value is moved into the upvalue.
+type vmUpvalue struct {
+	slot   int
+	closed bool
+	value  Value
+	next   *vmUpvalue // open upvalues are kept sorted by slot, highest first
+}
+
+type vmClass struct {
+	name    string
+	methods map[string]*vmClosure
+}
+
+func (c *vmClass) String() string {
+	return c.name
+}
+
+type vmInstance struct {
+	class  *vmClass
+	fields map[string]Value
+}
+
+func (i *vmInstance) String() string {
+	return fmt.Sprintf("%s instance", i.class.name)
+}
+
+type vmBoundMethod struct {
+	receiver Value
+	method   *vmClosure
+}
+
+func (b *vmBoundMethod) String() string {
+	return b.method.String()
+}
+
+// handler is an active try statement: where to resume when an error is
+// caught and how many frames and stack values lie outside the try.
+type handler struct {
+	frames int
+	stack  int
+	ip     int
+}
+
+type callFrame struct {
+	closure *vmClosure
+	name    string // what the callee was called as, for stack traces
+	ip      int
+	base    int // stack index of slot zero
+}
+
+// vm executes compiled bytecode on a value stack.
+type vm struct {
+	stack        []Value
+	frames       []callFrame
+	builtins     map[string]Value // natives, shared by the script and every module
+	globals      map[string]Value // of the script
+	openUpvalues *vmUpvalue
+	handlers     []handler
+	modules      *moduleLoader
+	limits       *limits
+	tracer       *tracer
+	stdout       io.Writer // where print writes
+}
+
+func newVM(modules *moduleLoader, limits *limits, tracer *tracer, stdout io.Writer) *vm {
+	return &vm{
+		stack:    make([]Value, 0, 256),
+		frames:   make([]callFrame, 0, 64),
+		builtins: make(map[string]Value),
+		globals:  make(map[string]Value),
+		modules:  modules,
+		limits:   limits,
+		tracer:   tracer,
+		stdout:   stdout,
+	}
+}
+
+func (vm *vm) define(name string, value Value) {
+	vm.builtins[name] = value
+}
+
+func (vm *vm) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *vm) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *vm) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *vm) reset() {
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.openUpvalues = nil
+	vm.handlers = vm.handlers[:0]
+}
+
+// interpret runs a compiled script and returns the value it produces.
+func (vm *vm) interpret(function *vmFunction) (Value, error) {
+	closure := &vmClosure{function: function, globals: vm.globals}
+	vm.push(closure)
+	vm.frames = append(vm.frames, callFrame{closure: closure, name: "<script>", base: 0})
+
+	value, err := vm.run(0)
+	if err != nil {
+		vm.reset()
+		return nil, err
+	}
+	return value, nil
+}
+
+// runModule runs a compiled module on top of the importing code and returns its globals.
+func (vm *vm) runModule(function *vmFunction, file string) (map[string]Value, error) {
+	globals := make(map[string]Value)
+	closure := &vmClosure{function: function, globals: globals}
+	vm.push(closure)
+	vm.frames = append(vm.frames, callFrame{closure: closure, name: filepath.Base(file), base: len(vm.stack) - 1})
+
+	_, err := vm.run(len(vm.frames) - 1)
+	return globals, err
+}
+
+// runtimeError builds an error located at the instruction being executed,
+// with a trace of every call still active.
+func (vm *vm) runtimeError(format string, args ...interface{}) *RuntimeError {
+	err := newRuntimeError(vm.span(), format, args...)
+	err.Trace = vm.trace()
+	return err
+}
+
+// span locates the instruction being executed.
+func (vm *vm) span() tokens.Span {
+	frame := &vm.frames[len(vm.frames)-1]
+	return frame.closure.function.chunk.spans[frame.ip-1]
+}
+
+func (vm *vm) trace() []StackFrame {
+	trace := []StackFrame{}
+	for n := len(vm.frames) - 1; n > 0; n-- {
+		caller := &vm.frames[n-1]
+		trace = append(trace, StackFrame{
+			Function: vm.frames[n].name,
+			CallSite: caller.closure.function.chunk.spans[caller.ip-1],
+		})
+	}
+	return trace
+}
+
+// run executes until the frame above base returns, resuming at the innermost
+// handler within those frames whenever a runtime error is raised.
+// The handler's code finds the error on top of the stack.
+func (vm *vm) run(base int) (Value, error) {
+	for {
+		value, err := vm.execute(base)
+		runtimeErr, ok := err.(*RuntimeError)
+		if !ok || len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frames <= base {
+			return value, err
+		}
+
+		h := vm.handlers[len(vm.handlers)-1]
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		vm.closeUpvalues(h.stack)
+		vm.frames = vm.frames[:h.frames]
+		vm.stack = vm.stack[:h.stack]
+		vm.push(runtimeErr)
+		vm.frames[len(vm.frames)-1].ip = h.ip
+	}
+}
+
+func (vm *vm) execute(base int) (Value, error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	code := frame.closure.function.chunk.code
+	constants := frame.closure.function.chunk.constants
+
+	readByte := func() byte {
+		b := code[frame.ip]
+		frame.ip++
+		return b
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+	}
+	readString := func() string {
+		return constants[readShort()].(string)
+	}
+	// reload caches the executing frame after a call or return
+	reload := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		code = frame.closure.function.chunk.code
+		constants = frame.closure.function.chunk.constants
+	}
+
+	for {
+		if err := vm.limits.step(); err != nil {
+			return nil, &AbortError{Span: frame.closure.function.chunk.spans[frame.ip], Err: err}
+		}
+
+		switch opcode(readByte()) {
+		case opConstant:
+			vm.push(constants[readShort()])
+		case opNil:
+			vm.push(nil)
+		case opTrue:
+			vm.push(true)
+		case opFalse:
+			vm.push(false)
+		case opPop:
+			vm.pop()
+		case opGetLocal:
+			vm.push(vm.stack[frame.base+int(readByte())])
+		case opSetLocal:
+			vm.stack[frame.base+int(readByte())] = vm.peek(0)
+		case opGetGlobal:
+			name := readString()
+			value, ok := frame.closure.globals[name]
+			if !ok {
+				value, ok = vm.builtins[name]
+			}
+			if !ok {
+				return nil, vm.runtimeError("Undefined variable '%s' when getting.", name)
+			}
+			vm.push(value)
+		case opDefineGlobal:
+			frame.closure.globals[readString()] = vm.pop()
+		case opSetGlobal:
+			name := readString()
+			if _, ok := frame.closure.globals[name]; ok {
+				frame.closure.globals[name] = vm.peek(0)
+			} else if _, ok := vm.builtins[name]; ok {
+				vm.builtins[name] = vm.peek(0)
+			} else {
+				return nil, vm.runtimeError("Undefined variable '%s' when assigning.", name)
+			}
+		case opGetUpvalue:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.closed {
+				vm.push(upvalue.value)
+			} else {
+				vm.push(vm.stack[upvalue.slot])
+			}
+		case opSetUpvalue:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.closed {
+				upvalue.value = vm.peek(0)
+			} else {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			}
+		case opGetProperty:
+			name := readString()
+			if m, ok := vm.peek(0).(*LoxModule); ok {
+				value, err := m.get(name)
+				if err != nil {
+					return nil, vm.runtimeError("%s", err.Error())
+				}
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			if e, ok := vm.peek(0).(*LoxError); ok {
+				value, err := e.get(name)
+				if err != nil {
+					return nil, vm.runtimeError("%s", err.Error())
+				}
+				vm.pop()
+				vm.push(value)
+				break
+			}
+
+			instance, ok := vm.peek(0).(*vmInstance)
+			if !ok {
+				return nil, vm.runtimeError("Only instances have properties.")
+			}
+
+			if value, ok := instance.fields[name]; ok {
+				vm.pop()
+				vm.push(value)
+				break
+			}
+			if err := vm.bindMethod(instance.class, name); err != nil {
+				return nil, err
+			}
+		case opSetProperty:
+			instance, ok := vm.peek(1).(*vmInstance)
+			if !ok {
+				return nil, vm.runtimeError("Only instances have fields.")
+			}
+			instance.fields[readString()] = vm.peek(0)
+			value := vm.pop()
+			vm.pop()
+			vm.push(value)
+		case opGetSuper:
+			name := readString()
+			superclass := vm.pop().(*vmClass)
+			if err := vm.bindMethod(superclass, name); err != nil {
+				return nil, err
+			}
+		case opEqual:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(isEqual(a, b))
+		case opGreater, opGreaterEqual, opLess, opLessEqual, opSubtract, opMultiply, opDivide:
+			if err := vm.numberOp(opcode(code[frame.ip-1])); err != nil {
+				return nil, err
+			}
+		case opAdd:
+			a, aok := vm.peek(1).(float64)
+			b, bok := vm.peek(0).(float64)
+			if aok && bok {
+				vm.pop()
+				vm.stack[len(vm.stack)-1] = a + b
+				break
+			}
+			sa, aok := vm.peek(1).(string)
+			sb, bok := vm.peek(0).(string)
+			if aok && bok {
+				vm.pop()
+				vm.stack[len(vm.stack)-1] = sa + sb
+				break
+			}
+			return nil, vm.runtimeError("Operands must be two numbers or two strings.")
+		case opNot:
+			vm.stack[len(vm.stack)-1] = !isTruthy(vm.peek(0))
+		case opNegate:
+			num, ok := vm.peek(0).(float64)
+			if !ok {
+				return nil, vm.runtimeError("Operand must be a number.")
+			}
+			vm.stack[len(vm.stack)-1] = -num
+		case opPrint:
+			fmt.Fprintln(vm.stdout, stringify(vm.pop()))
+		case opJump:
+			offset := readShort()
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := readShort()
+			frame.ip -= offset
+		case opCall:
+			argCount := int(readByte())
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return nil, err
+			}
+			reload()
+		case opClosure:
+			function := constants[readShort()].(*vmFunction)
+			closure := &vmClosure{
+				function: function,
+				upvalues: make([]*vmUpvalue, function.upvalueCount),
+				globals:  frame.closure.globals,
+			}
+			for n := range closure.upvalues {
+				isLocal := readByte() == 1
+				index := int(readByte())
+				if isLocal {
+					closure.upvalues[n] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[n] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case opCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case opReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == base {
+				vm.stack = vm.stack[:frame.base]
+				return result, nil
+			}
+
+			vm.stack = vm.stack[:frame.base]
+			vm.push(result)
+			reload()
+		case opClass:
+			vm.push(&vmClass{name: readString(), methods: make(map[string]*vmClosure)})
+		case opInherit:
+			superclass, ok := vm.peek(1).(*vmClass)
+			if !ok {
+				return nil, vm.runtimeError("Superclass must be a class.")
+			}
+			subclass := vm.peek(0).(*vmClass)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.pop()
+		case opMethod:
+			method := vm.peek(0).(*vmClosure)
+			class := vm.peek(1).(*vmClass)
+			class.methods[readString()] = method
+			vm.pop()
+		case opBuildList:
+			count := readShort()
+			elements := make([]Value, count)
+			copy(elements, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(NewLoxList(elements))
+		case opGetIndex:
+			value, err := getIndex(vm.peek(1), vm.peek(0))
+			if err != nil {
+				return nil, vm.runtimeError("%s", err.Error())
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2]
+			vm.push(value)
+		case opSetIndex:
+			value := vm.peek(0)
+			if err := setIndex(vm.peek(2), vm.peek(1), value); err != nil {
+				return nil, vm.runtimeError("%s", err.Error())
+			}
+			vm.stack = vm.stack[:len(vm.stack)-3]
+			vm.push(value)
+		case opBuildMap:
+			count := readShort()
+			m := NewLoxMap()
+			entries := vm.stack[len(vm.stack)-2*count:]
+			for n := 0; n < len(entries); n += 2 {
+				if err := m.set(entries[n], entries[n+1]); err != nil {
+					return nil, vm.runtimeError("%s", err.Error())
+				}
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*count]
+			vm.push(m)
+		case opPushHandler:
+			offset := readShort()
+			vm.handlers = append(vm.handlers, handler{frames: len(vm.frames), stack: len(vm.stack), ip: frame.ip + offset})
+		case opPopHandler:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case opImport:
+			path := readString()
+			module, err := vm.modules.load(path, frame.closure.function.chunk.spans[frame.ip-1])
+			if err != nil {
+				if _, ok := err.(*RuntimeError); ok || stopsProgram(err) {
+					return nil, err
+				}
+				return nil, vm.runtimeError("%s", err.Error())
+			}
+			reload()
+			vm.push(module)
+		case opImportAll:
+			module := vm.pop().(*LoxModule)
+			for name, value := range module.values {
+				frame.closure.globals[name] = value
+			}
+		case opCatch:
+			vm.stack[len(vm.stack)-1] = caughtValue(vm.peek(0).(*RuntimeError))
+		case opThrow:
+			// a finally block raises the error it interrupted unchanged
+			if err, ok := vm.peek(0).(*RuntimeError); ok {
+				return nil, err
+			}
+			err := throwError(frame.closure.function.chunk.spans[frame.ip-1], vm.pop())
+			if err.Trace == nil {
+				err.Trace = vm.trace()
+			}
+			return nil, err
+		}
+	}
+}
+
+// numberOp applies a binary operator defined only on numbers to the top two stack values.
+func (vm *vm) numberOp(op opcode) error {
+	a, aok := vm.peek(1).(float64)
+	b, bok := vm.peek(0).(float64)
+	if !aok || !bok {
+		return vm.runtimeError("Operands must be numbers.")
+	}
+
+	var result Value
+	switch op {
+	case opGreater:
+		result = a > b
+	case opGreaterEqual:
+		result = a >= b
+	case opLess:
+		result = a < b
+	case opLessEqual:
+		result = a <= b
+	case opSubtract:
+		result = a - b
+	case opMultiply:
+		result = a * b
+	case opDivide:
+		result = a / b
+	}
+
+	vm.pop()
+	vm.stack[len(vm.stack)-1] = result
+	return nil
+}
+
+// bindMethod replaces the instance on top of the stack with the named method bound to it.
+func (vm *vm) bindMethod(class *vmClass, name string) error {
+	method, ok := class.methods[name]
+	if !ok {
+		return vm.runtimeError("Undefined property '%s'.", name)
+	}
+
+	bound := &vmBoundMethod{receiver: vm.peek(0), method: method}
+	vm.pop()
+	vm.push(bound)
+	return nil
+}
+
+func (vm *vm) callValue(callee Value, argCount int) error {
+	switch callee := callee.(type) {
+	case *vmClosure:
+		return vm.call(callee, callee.function.name, argCount)
+	case *vmBoundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = callee.receiver
+		return vm.call(callee.method, callee.method.function.name, argCount)
+	case *vmClass:
+		vm.stack[len(vm.stack)-argCount-1] = &vmInstance{class: callee, fields: make(map[string]Value)}
+		if initializer, ok := callee.methods["init"]; ok {
+			return vm.call(initializer, callee.name, argCount)
+		}
+		if argCount != 0 {
+			return vm.runtimeError("Expected 0 arguments but got %d.", argCount)
+		}
+		return nil
+	case *NativeFunction:
+		return vm.callNative(callee, argCount)
+	}
+	return vm.runtimeError("Can only call functions and classes.")
+}
+
+func (vm *vm) call(closure *vmClosure, name string, argCount int) error {
+	if argCount != closure.function.arity {
+		return vm.runtimeError("Expected %d arguments but got %d.", closure.function.arity, argCount)
+	}
+	if err := vm.limits.enter(len(vm.frames)); err != nil {
+		return stackOverflow(vm.span(), vm.trace())
+	}
+	if vm.tracer != nil {
+		vm.tracer.emit(PhaseInterpret, "call", vm.span(), map[string]interface{}{
+			"function": name,
+			"depth":    len(vm.frames),
+		})
+	}
+
+	vm.frames = append(vm.frames, callFrame{
+		closure: closure,
+		name:    name,
+		base:    len(vm.stack) - argCount - 1,
+	})
+	return nil
+}
+
+func (vm *vm) callNative(native *NativeFunction, argCount int) error {
+	if native.Arity() != Variadic && argCount != native.Arity() {
+		return vm.runtimeError("Expected %d arguments but got %d.", native.Arity(), argCount)
+	}
+
+	// natives may hold on to their arguments, so they get a copy of the stack window
+	args := make([]Value, argCount)
+	copy(args, vm.stack[len(vm.stack)-argCount:])
+
+	result, err := native.Fn(args)
+	if err != nil {
+		if stopsProgram(err) {
+			return err
+		}
+		runtimeErr := vm.runtimeError("%s", err.Error())
+		runtimeErr.Trace = append([]StackFrame{{Function: native.Name, CallSite: runtimeErr.Span}}, runtimeErr.Trace...)
+		return runtimeErr
+	}
+
+	vm.stack = vm.stack[:len(vm.stack)-argCount-1]
+	vm.push(result)
+	return nil
+}
+
+// captureUpvalue returns the open upvalue for the stack slot, creating it if no closure has captured the slot yet.
+func (vm *vm) captureUpvalue(slot int) *vmUpvalue {
+	var prev *vmUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prev = upvalue
+		upvalue = upvalue.next
+	}
+
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &vmUpvalue{slot: slot, next: upvalue}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves every captured variable at or above the stack slot off the stack.
+func (vm *vm) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.value = vm.stack[upvalue.slot]
+		upvalue.closed = true
+		vm.openUpvalues = upvalue.next
+	}
+}
@@ -7,6 +7,22 @@ import (
 
 type Stmt interface {
 	Accept(v Visitor) error
+	Span() tokens.Span
+}
+
+type ClassStmt struct {
+	Name       tokens.Token
+	Superclass *expressions.Variable // possibly nil
+	Methods    []FunctionStmt
+}
+
+func (s ClassStmt) Accept(v Visitor) error {
+	return v.VisitClassStmt(s)
+}
+
+// Span covers the class name.
+func (s ClassStmt) Span() tokens.Span {
+	return s.Name.Span()
 }
 
 type ExpStmt struct {
@@ -17,6 +33,10 @@ func (s ExpStmt) Accept(v Visitor) error {
 	return v.VisitExpressionStmt(s)
 }
 
+func (s ExpStmt) Span() tokens.Span {
+	return s.Expression.Span()
+}
+
 type FunctionStmt struct {
 	Name   tokens.Token
 	Params []tokens.Token
@@ -27,7 +47,13 @@ func (s FunctionStmt) Accept(v Visitor) error {
 	return v.VisitFunctionStmt(s)
 }
 
+// Span covers the function name.
+func (s FunctionStmt) Span() tokens.Span {
+	return s.Name.Span()
+}
+
 type PrintStmt struct {
+	Keyword    tokens.Token
 	Expression expressions.Expression
 }
 
@@ -35,6 +61,10 @@ func (s PrintStmt) Accept(v Visitor) error {
 	return v.VisitPrintStmt(s)
 }
 
+func (s PrintStmt) Span() tokens.Span {
+	return tokens.Join(s.Keyword.Span(), s.Expression.Span())
+}
+
 type ReturnStmt struct {
 	Keyword tokens.Token
 	Value   expressions.Expression // might be nil!
@@ -44,6 +74,13 @@ func (s ReturnStmt) Accept(v Visitor) error {
 	return v.VisitReturnStmt(s)
 }
 
+func (s ReturnStmt) Span() tokens.Span {
+	if s.Value == nil {
+		return s.Keyword.Span()
+	}
+	return tokens.Join(s.Keyword.Span(), s.Value.Span())
+}
+
 type VarStmt struct {
 	Name        tokens.Token
 	Initializer expressions.Expression
@@ -53,15 +90,36 @@ func (s VarStmt) Accept(v Visitor) error {
 	return v.VisitVarStmt(s)
 }
 
+func (s VarStmt) Span() tokens.Span {
+	if s.Initializer == nil {
+		return s.Name.Span()
+	}
+	return tokens.Join(s.Name.Span(), s.Initializer.Span())
+}
+
 type Block struct {
+	LeftBrace  tokens.Token // zero for blocks synthesized by the parser
 	Statements []Stmt
+	RightBrace tokens.Token
 }
 
 func (s Block) Accept(v Visitor) error {
 	return v.VisitBlock(s)
 }
 
+// Span covers the braces. A synthesized block runs from its first to its last statement.
+func (s Block) Span() tokens.Span {
+	if s.LeftBrace.Lexeme != "" {
+		return tokens.Join(s.LeftBrace.Span(), s.RightBrace.Span())
+	}
+	if len(s.Statements) == 0 {
+		return tokens.Span{}
+	}
+	return tokens.Join(s.Statements[0].Span(), s.Statements[len(s.Statements)-1].Span())
+}
+
 type IfStmt struct {
+	Keyword    tokens.Token
 	Condition  expressions.Expression
 	ThenBranch Stmt
 	ElseBranch Stmt // possibly nil
@@ -71,11 +129,111 @@ func (s IfStmt) Accept(v Visitor) error {
 	return v.VisitIfStmt(s)
 }
 
+func (s IfStmt) Span() tokens.Span {
+	if s.ElseBranch == nil {
+		return tokens.Join(s.Keyword.Span(), s.ThenBranch.Span())
+	}
+	return tokens.Join(s.Keyword.Span(), s.ElseBranch.Span())
+}
+
 type WhileStmt struct {
+	Keyword   tokens.Token // 'while', or 'for' when desugared from a for loop
 	Condition expressions.Expression
 	Body      Stmt
+	Increment expressions.Expression // might be nil! runs after the body, including on continue
 }
 
 func (s WhileStmt) Accept(v Visitor) error {
 	return v.VisitWhileStmt(s)
 }
+
+func (s WhileStmt) Span() tokens.Span {
+	return tokens.Join(s.Keyword.Span(), s.Body.Span())
+}
+
+type BreakStmt struct {
+	Keyword tokens.Token
+}
+
+func (s BreakStmt) Accept(v Visitor) error {
+	return v.VisitBreakStmt(s)
+}
+
+func (s BreakStmt) Span() tokens.Span {
+	return s.Keyword.Span()
+}
+
+type ContinueStmt struct {
+	Keyword tokens.Token
+}
+
+func (s ContinueStmt) Accept(v Visitor) error {
+	return v.VisitContinueStmt(s)
+}
+
+func (s ContinueStmt) Span() tokens.Span {
+	return s.Keyword.Span()
+}
+
+type ThrowStmt struct {
+	Keyword tokens.Token
+	Value   expressions.Expression
+}
+
+func (s ThrowStmt) Accept(v Visitor) error {
+	return v.VisitThrowStmt(s)
+}
+
+func (s ThrowStmt) Span() tokens.Span {
+	return tokens.Join(s.Keyword.Span(), s.Value.Span())
+}
+
+// TryStmt has a catch clause, a finally block or both.
+type TryStmt struct {
+	Keyword tokens.Token
+	Body    Block
+	Catch   *CatchClause // might be nil!
+	Finally *Block       // might be nil!
+}
+
+func (s TryStmt) Accept(v Visitor) error {
+	return v.VisitTryStmt(s)
+}
+
+// Span runs from the keyword to the closing brace of the last clause.
+func (s TryStmt) Span() tokens.Span {
+	if s.Finally != nil {
+		return tokens.Join(s.Keyword.Span(), s.Finally.Span())
+	}
+	if s.Catch != nil {
+		return tokens.Join(s.Keyword.Span(), s.Catch.RightBrace.Span())
+	}
+	return tokens.Join(s.Keyword.Span(), s.Body.Span())
+}
+
+// CatchClause binds the caught error to Name for the statements of its body.
+type CatchClause struct {
+	Keyword    tokens.Token
+	Name       tokens.Token
+	Body       []Stmt
+	RightBrace tokens.Token
+}
+
+// ImportStmt loads a module. With a Name the module is bound as a namespace,
+// otherwise its top-level variables are defined in the importing script.
+type ImportStmt struct {
+	Keyword tokens.Token
+	Path    tokens.Token
+	Name    *tokens.Token // might be nil!
+}
+
+func (s ImportStmt) Accept(v Visitor) error {
+	return v.VisitImportStmt(s)
+}
+
+func (s ImportStmt) Span() tokens.Span {
+	if s.Name == nil {
+		return tokens.Join(s.Keyword.Span(), s.Path.Span())
+	}
+	return tokens.Join(s.Keyword.Span(), s.Name.Span())
+}
@@ -1,6 +1,7 @@
 package statements
 
 type Visitor interface {
+	VisitClassStmt(ClassStmt) error
 	VisitExpressionStmt(ExpStmt) error
 	VisitFunctionStmt(FunctionStmt) error
 	VisitPrintStmt(PrintStmt) error
@@ -9,4 +10,9 @@ type Visitor interface {
 	VisitBlock(Block) error
 	VisitIfStmt(IfStmt) error
 	VisitWhileStmt(WhileStmt) error
+	VisitBreakStmt(BreakStmt) error
+	VisitContinueStmt(ContinueStmt) error
+	VisitThrowStmt(ThrowStmt) error
+	VisitTryStmt(TryStmt) error
+	VisitImportStmt(ImportStmt) error
 }
@@ -10,7 +10,10 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
+	COLON
 	DOT
 	MINUS
 	PLUS
@@ -35,60 +38,167 @@ const (
 
 	// keywords
 	AND
+	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
 	EOF
 )
 
+var tokenTypeNames = [...]string{
+	LEFT_PAREN:    "LEFT_PAREN",
+	RIGHT_PAREN:   "RIGHT_PAREN",
+	LEFT_BRACE:    "LEFT_BRACE",
+	RIGHT_BRACE:   "RIGHT_BRACE",
+	LEFT_BRACKET:  "LEFT_BRACKET",
+	RIGHT_BRACKET: "RIGHT_BRACKET",
+	COMMA:         "COMMA",
+	COLON:         "COLON",
+	DOT:           "DOT",
+	MINUS:         "MINUS",
+	PLUS:          "PLUS",
+	SEMICOLON:     "SEMICOLON",
+	SLASH:         "SLASH",
+	STAR:          "STAR",
+	BANG:          "BANG",
+	BANG_EQUAL:    "BANG_EQUAL",
+	EQUAL:         "EQUAL",
+	EQUAL_EQUAL:   "EQUAL_EQUAL",
+	GREATER:       "GREATER",
+	GREATER_EQUAL: "GREATER_EQUAL",
+	LESS:          "LESS",
+	LESS_EQUAL:    "LESS_EQUAL",
+	IDENTIFIER:    "IDENTIFIER",
+	STRING:        "STRING",
+	NUMBER:        "NUMBER",
+	AND:           "AND",
+	BREAK:         "BREAK",
+	CATCH:         "CATCH",
+	CLASS:         "CLASS",
+	CONTINUE:      "CONTINUE",
+	ELSE:          "ELSE",
+	FALSE:         "FALSE",
+	FINALLY:       "FINALLY",
+	FUN:           "FUN",
+	FOR:           "FOR",
+	IF:            "IF",
+	IMPORT:        "IMPORT",
+	NIL:           "NIL",
+	OR:            "OR",
+	PRINT:         "PRINT",
+	RETURN:        "RETURN",
+	SUPER:         "SUPER",
+	THIS:          "THIS",
+	THROW:         "THROW",
+	TRUE:          "TRUE",
+	TRY:           "TRY",
+	VAR:           "VAR",
+	WHILE:         "WHILE",
+	EOF:           "EOF",
+}
+
+// String returns the name of the token type's constant.
+func (tt TokenType) String() string {
+	if int(tt) < 0 || int(tt) >= len(tokenTypeNames) {
+		return fmt.Sprintf("TokenType(%d)", int(tt))
+	}
+	return tokenTypeNames[tt]
+}
+
 var KeywordsMap = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
+}
+
+// Position is a location in Lox source.
+type Position struct {
+	File   string // empty for source that didn't come from a file
+	Line   int    // 1-based
+	Column int    // 1-based, counted in runes
+	Offset int    // 0-based, counted in bytes
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Span is the range of source covered by a token or syntax node.
+// End is exclusive. Nodes synthesized by the parser have a zero span.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// Join returns the span from the start of 'from' to the end of 'to'.
+func Join(from, to Span) Span {
+	return Span{Start: from.Start, End: to.End}
 }
 
 type Token struct {
 	TokenType TokenType
 	Lexeme    string
 	Literal   interface{}
-	LineNum   int
+	Start     Position
+	End       Position
+}
+
+func (t Token) Span() Span {
+	return Span{Start: t.Start, End: t.End}
 }
 
 func (t Token) String() string {
 	return fmt.Sprintf(t.Lexeme)
 }
 
-func NewToken(tt TokenType, Lexeme string, Literal interface{}, LineNum int) *Token {
+func NewToken(tt TokenType, Lexeme string, Literal interface{}, start, end Position) *Token {
 	return &Token{
 		TokenType: tt,
 		Lexeme:    Lexeme,
 		Literal:   Literal,
-		LineNum:   LineNum,
+		Start:     start,
+		End:       end,
 	}
 }